@@ -0,0 +1,413 @@
+package bench
+
+import (
+	"bytes"
+	"crypto"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/emersion/go-message"
+	_ "github.com/emersion/go-message/charset"
+	"github.com/emersion/go-smtp"
+	"golang.org/x/text/transform"
+	"xorkevin.dev/mailcat/send"
+	"xorkevin.dev/mailcat/transformer"
+	"xorkevin.dev/mailcat/uid"
+)
+
+type (
+	Opts struct {
+		Addr         string
+		Username     string
+		Password     string
+		From         string
+		To           string
+		DKIMSelector string
+		DKIMKeyFile  string
+		MsgIDDomain  string
+		Count        int
+		Concurrency  int
+		Rate         float64
+	}
+
+	// Result is the outcome of a benchmark run
+	Result struct {
+		Sent     int
+		Failed   int
+		Duration time.Duration
+		Stages   []StageStats
+		Errors   []ErrorCount
+	}
+
+	// StageStats are latency statistics of an smtp stage
+	StageStats struct {
+		Stage string
+		Count int
+		Mean  time.Duration
+		P50   time.Duration
+		P90   time.Duration
+		P99   time.Duration
+		Max   time.Duration
+	}
+
+	// ErrorCount is the number of errors of a kind
+	ErrorCount struct {
+		Stage string
+		Err   string
+		Count int
+	}
+
+	errKey struct {
+		stage string
+		err   string
+	}
+
+	recorder struct {
+		mu      sync.Mutex
+		stages  map[string][]time.Duration
+		errs    map[errKey]int
+		sent    int
+		failed  int
+		tmpl    []byte
+		domain  string
+		from    string
+		to      string
+		dkimSel string
+		dkimKey crypto.Signer
+	}
+)
+
+var (
+	ErrInvalidArgs = errors.New("Invalid args")
+)
+
+const (
+	headerMsgID = "Message-ID"
+
+	msgidRandBytes = 16
+
+	// stageTotal is the latency of an entire message delivery
+	stageTotal = "total"
+	// stageSession attributes errors that occur outside of an smtp command
+	stageSession = "session"
+	stageQuit    = "quit"
+)
+
+// stageOrder is the order in which stages are reported
+var stageOrder = []send.Stage{
+	send.StageConnect,
+	send.StageHello,
+	send.StageTLS,
+	send.StageAuth,
+	send.StageReset,
+	send.StageMail,
+	send.StageRcpt,
+	send.StageData,
+}
+
+// Bench sends a template message read from r many times across concurrent
+// smtp sessions, and writes a report of the results to w
+func Bench(r io.Reader, w io.Writer, opts Opts) error {
+	res, err := Run(r, opts)
+	if err != nil {
+		return err
+	}
+	if err := res.WriteReport(w); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Run sends a template message read from r many times across concurrent smtp
+// sessions. Each message is sent with a unique Message-ID.
+func Run(r io.Reader, opts Opts) (*Result, error) {
+	if opts.Addr == "" {
+		return nil, fmt.Errorf("%w: no address", ErrInvalidArgs)
+	}
+	if opts.Count < 1 {
+		return nil, fmt.Errorf("%w: count must be positive", ErrInvalidArgs)
+	}
+	if opts.Concurrency < 1 {
+		return nil, fmt.Errorf("%w: concurrency must be positive", ErrInvalidArgs)
+	}
+	if opts.Rate < 0 || math.IsNaN(opts.Rate) || math.IsInf(opts.Rate, 0) {
+		return nil, fmt.Errorf("%w: rate must be a finite non-negative number", ErrInvalidArgs)
+	}
+	tmpl, err := readTemplate(r)
+	if err != nil {
+		return nil, err
+	}
+	rec := &recorder{
+		stages:  map[string][]time.Duration{},
+		errs:    map[errKey]int{},
+		tmpl:    tmpl,
+		domain:  opts.MsgIDDomain,
+		from:    opts.From,
+		to:      opts.To,
+		dkimSel: opts.DKIMSelector,
+	}
+	if opts.DKIMSelector != "" {
+		key, err := send.ReadDKIMKey(opts.DKIMKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		rec.dkimKey = key
+	}
+	// validate the template before beginning the benchmark
+	if _, err := rec.newMsg(); err != nil {
+		return nil, err
+	}
+
+	jobs := make(chan struct{})
+	go func() {
+		defer close(jobs)
+		if opts.Rate == 0 {
+			for i := 0; i < opts.Count; i++ {
+				jobs <- struct{}{}
+			}
+			return
+		}
+		ticker := time.NewTicker(rateInterval(opts.Rate))
+		defer ticker.Stop()
+		for i := 0; i < opts.Count; i++ {
+			if i > 0 {
+				<-ticker.C
+			}
+			jobs <- struct{}{}
+		}
+	}()
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < opts.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rec.worker(jobs, opts)
+		}()
+	}
+	wg.Wait()
+	return rec.result(time.Since(start)), nil
+}
+
+// rateInterval returns the interval between messages sent at rate messages
+// per second, which is at least 1ns since a ticker requires a positive
+// interval
+func rateInterval(rate float64) time.Duration {
+	d := float64(time.Second) / rate
+	if d >= math.MaxInt64 {
+		return math.MaxInt64
+	}
+	return max(time.Duration(d), 1)
+}
+
+func readTemplate(r io.Reader) ([]byte, error) {
+	m, err := message.Read(transform.NewReader(r, transformer.CRLF{}))
+	if err != nil {
+		return nil, fmt.Errorf("Failed reading mail message: %w", err)
+	}
+	m.Header.Del(headerMsgID)
+	var b bytes.Buffer
+	if err := m.WriteTo(&b); err != nil {
+		return nil, fmt.Errorf("Failed writing mail message: %w", err)
+	}
+	return b.Bytes(), nil
+}
+
+func (r *recorder) newMsg() (send.Sender, error) {
+	u, err := uid.NewSnowflake(msgidRandBytes)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to generate msgid: %w", err)
+	}
+	s := send.New()
+	if err := s.ReadMsg(io.MultiReader(
+		strings.NewReader(fmt.Sprintf("%s: <%s@%s>\r\n", headerMsgID, u.Base32(), r.domain)),
+		bytes.NewReader(r.tmpl),
+	)); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (r *recorder) worker(jobs <-chan struct{}, opts Opts) {
+	// failedStage is the last stage of the current message to fail
+	var failedStage string
+	sess := send.NewSession(opts.Addr, opts.Username, opts.Password)
+	sess.SetTrace(func(stage send.Stage, d time.Duration, err error) {
+		if err != nil {
+			failedStage = string(stage)
+			return
+		}
+		r.recordStage(string(stage), d)
+	})
+	defer func() {
+		if err := sess.Close(); err != nil {
+			r.recordErr(stageQuit, err)
+		}
+	}()
+	for range jobs {
+		failedStage = stageSession
+		start := time.Now()
+		if err := r.sendMsg(sess); err != nil {
+			r.recordErr(failedStage, err)
+			r.mu.Lock()
+			r.failed++
+			r.mu.Unlock()
+			continue
+		}
+		r.recordStage(stageTotal, time.Since(start))
+		r.mu.Lock()
+		r.sent++
+		r.mu.Unlock()
+	}
+}
+
+func (r *recorder) sendMsg(sess *send.Session) error {
+	s, err := r.newMsg()
+	if err != nil {
+		return err
+	}
+	from, to := s.Envelope(r.from, r.to)
+	return sess.Deliver(from, to, func(w io.Writer) error {
+		return s.WriteMsg(w, r.dkimSel, r.dkimKey)
+	})
+}
+
+func (r *recorder) recordStage(stage string, d time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.stages[stage] = append(r.stages[stage], d)
+}
+
+// errKind groups errors by smtp reply code where possible
+func errKind(err error) string {
+	var smtpErr *smtp.SMTPError
+	if errors.As(err, &smtpErr) {
+		return fmt.Sprintf("%d %d.%d.%d %s", smtpErr.Code, smtpErr.EnhancedCode[0], smtpErr.EnhancedCode[1], smtpErr.EnhancedCode[2], smtpErr.Message)
+	}
+	return err.Error()
+}
+
+func (r *recorder) recordErr(stage string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.errs[errKey{stage: stage, err: errKind(err)}]++
+}
+
+func percentile(sorted []time.Duration, p int) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	// nearest rank
+	k := (len(sorted)*p + 99) / 100
+	if k < 1 {
+		k = 1
+	}
+	return sorted[k-1]
+}
+
+func stageStats(stage string, d []time.Duration) StageStats {
+	sorted := slices.Clone(d)
+	slices.Sort(sorted)
+	var sum time.Duration
+	for _, i := range sorted {
+		sum += i
+	}
+	return StageStats{
+		Stage: stage,
+		Count: len(sorted),
+		Mean:  sum / time.Duration(len(sorted)),
+		P50:   percentile(sorted, 50),
+		P90:   percentile(sorted, 90),
+		P99:   percentile(sorted, 99),
+		Max:   sorted[len(sorted)-1],
+	}
+}
+
+func (r *recorder) result(d time.Duration) *Result {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	res := &Result{
+		Sent:     r.sent,
+		Failed:   r.failed,
+		Duration: d,
+	}
+	for _, i := range stageOrder {
+		if v := r.stages[string(i)]; len(v) > 0 {
+			res.Stages = append(res.Stages, stageStats(string(i), v))
+		}
+	}
+	if v := r.stages[stageTotal]; len(v) > 0 {
+		res.Stages = append(res.Stages, stageStats(stageTotal, v))
+	}
+	for k, v := range r.errs {
+		res.Errors = append(res.Errors, ErrorCount{
+			Stage: k.stage,
+			Err:   k.err,
+			Count: v,
+		})
+	}
+	sort.Slice(res.Errors, func(i, j int) bool {
+		if res.Errors[i].Count != res.Errors[j].Count {
+			return res.Errors[i].Count > res.Errors[j].Count
+		}
+		if res.Errors[i].Stage != res.Errors[j].Stage {
+			return res.Errors[i].Stage < res.Errors[j].Stage
+		}
+		return res.Errors[i].Err < res.Errors[j].Err
+	})
+	return res
+}
+
+// Throughput returns the rate of successfully sent messages per second
+func (r *Result) Throughput() float64 {
+	if r.Duration <= 0 {
+		return 0
+	}
+	return float64(r.Sent) / r.Duration.Seconds()
+}
+
+// WriteReport writes a human readable report of the result
+func (r *Result) WriteReport(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "sent:\t%d\n", r.Sent)
+	fmt.Fprintf(tw, "failed:\t%d\n", r.Failed)
+	fmt.Fprintf(tw, "duration:\t%s\n", r.Duration.Round(time.Millisecond))
+	fmt.Fprintf(tw, "throughput:\t%.2f msg/s\n", r.Throughput())
+	if err := tw.Flush(); err != nil {
+		return fmt.Errorf("Failed writing report: %w", err)
+	}
+	if len(r.Stages) > 0 {
+		fmt.Fprintln(w)
+		fmt.Fprintln(tw, "stage\tcount\tmean\tp50\tp90\tp99\tmax")
+		for _, i := range r.Stages {
+			fmt.Fprintf(tw, "%s\t%d\t%s\t%s\t%s\t%s\t%s\n", i.Stage, i.Count, fmtDuration(i.Mean), fmtDuration(i.P50), fmtDuration(i.P90), fmtDuration(i.P99), fmtDuration(i.Max))
+		}
+		if err := tw.Flush(); err != nil {
+			return fmt.Errorf("Failed writing report: %w", err)
+		}
+	}
+	if len(r.Errors) > 0 {
+		fmt.Fprintln(w)
+		fmt.Fprintln(tw, "count\tstage\terror")
+		for _, i := range r.Errors {
+			fmt.Fprintf(tw, "%d\t%s\t%s\n", i.Count, i.Stage, i.Err)
+		}
+		if err := tw.Flush(); err != nil {
+			return fmt.Errorf("Failed writing report: %w", err)
+		}
+	}
+	return nil
+}
+
+func fmtDuration(d time.Duration) string {
+	return d.Round(10 * time.Microsecond).String()
+}
@@ -0,0 +1,197 @@
+package bench
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"xorkevin.dev/mailcat/send"
+)
+
+func Test_percentile(t *testing.T) {
+	t.Parallel()
+
+	ms := func(n ...int) []time.Duration {
+		d := make([]time.Duration, 0, len(n))
+		for _, i := range n {
+			d = append(d, time.Duration(i)*time.Millisecond)
+		}
+		return d
+	}
+
+	for _, tc := range []struct {
+		Name   string
+		Sorted []time.Duration
+		P      int
+		Exp    time.Duration
+	}{
+		{
+			Name:   "Empty",
+			Sorted: nil,
+			P:      50,
+			Exp:    0,
+		},
+		{
+			Name:   "Single",
+			Sorted: ms(7),
+			P:      99,
+			Exp:    7 * time.Millisecond,
+		},
+		{
+			Name:   "Nearest rank median",
+			Sorted: ms(1, 2, 3, 4),
+			P:      50,
+			Exp:    2 * time.Millisecond,
+		},
+		{
+			Name:   "Nearest rank rounds up",
+			Sorted: ms(1, 2, 3, 4, 5, 6, 7, 8, 9, 10),
+			P:      91,
+			Exp:    10 * time.Millisecond,
+		},
+		{
+			Name:   "Zero percentile is the min",
+			Sorted: ms(3, 4, 5),
+			P:      0,
+			Exp:    3 * time.Millisecond,
+		},
+		{
+			Name:   "Max percentile",
+			Sorted: ms(3, 4, 5),
+			P:      100,
+			Exp:    5 * time.Millisecond,
+		},
+	} {
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			assert := require.New(t)
+
+			assert.Equal(tc.Exp, percentile(tc.Sorted, tc.P))
+		})
+	}
+}
+
+func Test_recorder_result(t *testing.T) {
+	t.Parallel()
+
+	assert := require.New(t)
+
+	rec := &recorder{
+		stages: map[string][]time.Duration{},
+		errs:   map[errKey]int{},
+		sent:   3,
+		failed: 2,
+	}
+	for _, i := range []time.Duration{40, 10, 30, 20} {
+		rec.recordStage(stageTotal, i*time.Millisecond)
+	}
+	rec.recordStage(string(send.StageData), 5*time.Millisecond)
+	rec.recordStage(string(send.StageConnect), 2*time.Millisecond)
+	rec.recordErr(string(send.StageRcpt), errors.New("rejected"))
+	rec.recordErr(string(send.StageData), errors.New("timeout"))
+	rec.recordErr(string(send.StageRcpt), errors.New("rejected"))
+
+	res := rec.result(2 * time.Second)
+	assert.Equal(3, res.Sent)
+	assert.Equal(2, res.Failed)
+	assert.Equal(1.5, res.Throughput())
+	assert.Equal([]StageStats{
+		{
+			Stage: string(send.StageConnect),
+			Count: 1,
+			Mean:  2 * time.Millisecond,
+			P50:   2 * time.Millisecond,
+			P90:   2 * time.Millisecond,
+			P99:   2 * time.Millisecond,
+			Max:   2 * time.Millisecond,
+		},
+		{
+			Stage: string(send.StageData),
+			Count: 1,
+			Mean:  5 * time.Millisecond,
+			P50:   5 * time.Millisecond,
+			P90:   5 * time.Millisecond,
+			P99:   5 * time.Millisecond,
+			Max:   5 * time.Millisecond,
+		},
+		{
+			Stage: stageTotal,
+			Count: 4,
+			Mean:  25 * time.Millisecond,
+			P50:   20 * time.Millisecond,
+			P90:   40 * time.Millisecond,
+			P99:   40 * time.Millisecond,
+			Max:   40 * time.Millisecond,
+		},
+	}, res.Stages)
+	assert.Equal([]ErrorCount{
+		{Stage: string(send.StageRcpt), Err: "rejected", Count: 2},
+		{Stage: string(send.StageData), Err: "timeout", Count: 1},
+	}, res.Errors)
+
+	var b strings.Builder
+	assert.NoError(res.WriteReport(&b))
+	assert.Contains(b.String(), "throughput:  1.50 msg/s")
+}
+
+func Test_rateInterval(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		Name string
+		Rate float64
+		Exp  time.Duration
+	}{
+		{
+			Name: "Per second",
+			Rate: 4,
+			Exp:  250 * time.Millisecond,
+		},
+		{
+			Name: "Faster than a nanosecond",
+			Rate: 1e12,
+			Exp:  time.Nanosecond,
+		},
+		{
+			Name: "Slower than the max duration",
+			Rate: 1e-12,
+			Exp:  math.MaxInt64,
+		},
+	} {
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			assert := require.New(t)
+
+			assert.Equal(tc.Exp, rateInterval(tc.Rate))
+		})
+	}
+}
+
+func Test_Run_InvalidRate(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		Name string
+		Rate float64
+	}{
+		{Name: "Negative", Rate: -1},
+		{Name: "NaN", Rate: math.NaN()},
+		{Name: "Infinite", Rate: math.Inf(1)},
+	} {
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			assert := require.New(t)
+
+			_, err := Run(strings.NewReader(""), Opts{
+				Addr:        "localhost:25",
+				Count:       1,
+				Concurrency: 1,
+				Rate:        tc.Rate,
+			})
+			assert.ErrorIs(err, ErrInvalidArgs)
+		})
+	}
+}
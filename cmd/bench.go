@@ -0,0 +1,47 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/spf13/cobra"
+	"xorkevin.dev/mailcat/bench"
+)
+
+type (
+	benchFlags struct {
+		opts bench.Opts
+	}
+)
+
+func (c *Cmd) getBenchCmd() *cobra.Command {
+	benchCmd := &cobra.Command{
+		Use:   "bench",
+		Short: "Load tests an smtp server",
+		Long: `Load tests an smtp server
+
+Sends the template message read from stdin count times across concurrent smtp
+sessions, each message with a unique Message-ID, and reports throughput,
+latency percentiles per smtp stage, and errors.`,
+		Run:               c.execBenchCmd,
+		DisableAutoGenTag: true,
+	}
+	benchCmd.PersistentFlags().StringVarP(&c.benchFlags.opts.Addr, "server", "s", "", "smtp server address")
+	benchCmd.PersistentFlags().StringVarP(&c.benchFlags.opts.Username, "username", "u", "", "smtp auth username")
+	benchCmd.PersistentFlags().StringVarP(&c.benchFlags.opts.Password, "password", "a", "", "smtp auth password")
+	benchCmd.PersistentFlags().StringVarP(&c.benchFlags.opts.From, "from", "i", "", "smtp from (defaults to the From header address)")
+	benchCmd.PersistentFlags().StringVarP(&c.benchFlags.opts.To, "to", "o", "", "smtp to (defaults to the To, Cc, and Bcc header addresses)")
+	benchCmd.PersistentFlags().StringVar(&c.benchFlags.opts.DKIMSelector, "dkim-selector", "", "dkim selector")
+	benchCmd.PersistentFlags().StringVar(&c.benchFlags.opts.DKIMKeyFile, "dkim-keyfile", "", "dkim key file (PEM)")
+	benchCmd.PersistentFlags().StringVarP(&c.benchFlags.opts.MsgIDDomain, "msgid", "y", "mail.example.com", "generated message id domain")
+	benchCmd.PersistentFlags().IntVarP(&c.benchFlags.opts.Count, "count", "n", 1, "number of messages to send")
+	benchCmd.PersistentFlags().IntVarP(&c.benchFlags.opts.Concurrency, "concurrency", "c", 1, "number of concurrent smtp sessions")
+	benchCmd.PersistentFlags().Float64VarP(&c.benchFlags.opts.Rate, "rate", "r", 0, "target rate of messages per second (0 is unlimited)")
+	return benchCmd
+}
+
+func (c *Cmd) execBenchCmd(cmd *cobra.Command, args []string) {
+	if err := bench.Bench(os.Stdin, os.Stdout, c.benchFlags.opts); err != nil {
+		c.logFatal(err)
+		return
+	}
+}
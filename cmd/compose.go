@@ -0,0 +1,92 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"xorkevin.dev/mailcat/formatter"
+	"xorkevin.dev/mailcat/send"
+)
+
+type (
+	composeFlags struct {
+		opts     formatter.Opts
+		sendOpts send.Opts
+	}
+)
+
+func (c *Cmd) getComposeCmd() *cobra.Command {
+	composeCmd := &cobra.Command{
+		Use:   "compose [draft]",
+		Short: "Composes mail in an editor",
+		Long: `Composes mail in an editor
+
+Opens a draft in $VISUAL or $EDITOR, starting from the draft file if provided,
+and otherwise an empty message. When the editor exits, the draft is validated,
+and the editor is reopened on error. The final formatted message is written to
+stdout, or sent if a server is provided.`,
+		Args:              cobra.MaximumNArgs(1),
+		Run:               c.execComposeCmd,
+		DisableAutoGenTag: true,
+	}
+	composeCmd.PersistentFlags().BoolVarP(&c.composeFlags.opts.CRLF, "crlf", "m", false, "output with CRLF line endings")
+	composeCmd.PersistentFlags().StringArrayVarP(&c.composeFlags.opts.Headers, "header", "s", nil, "set default header value (HEADER:VALUE); may be specified multiple times")
+	composeCmd.PersistentFlags().StringArrayVarP(&c.composeFlags.opts.AddHeaders, "add", "a", nil, "specify header values to be added (HEADER:VALUE); may be specified multiple times")
+	composeCmd.PersistentFlags().StringVarP(&c.composeFlags.opts.MsgIDDomain, "msgid", "y", "mail.example.com", "set default generated message id domain")
+	composeCmd.PersistentFlags().BoolVar(&c.composeFlags.opts.Reply, "reply", false, "compose a reply to the draft message quoting its body")
+	composeCmd.PersistentFlags().BoolVar(&c.composeFlags.opts.ReplyAll, "reply-all", false, "compose a reply to the draft message that is also sent to its recipients other than the From header address")
+	composeCmd.PersistentFlags().StringVar(&c.composeFlags.opts.Forward, "forward", "", "compose a forward of the draft message, either quoted inline (inline) or attached unchanged as message/rfc822 (attach)")
+	composeCmd.PersistentFlags().Lookup("forward").NoOptDefVal = formatter.ForwardInline
+	composeCmd.PersistentFlags().StringArrayVarP(&c.composeFlags.opts.Attachments, "attach", "f", nil, "attach a file (path[;type=TYPE;name=NAME]) in a multipart/mixed message; may be specified multiple times")
+	composeCmd.PersistentFlags().Int64Var(&c.composeFlags.opts.Seed, "seed", 0, "seed generated Message-IDs, Content-IDs, and boundaries for reproducible output, with the Date from $SOURCE_DATE_EPOCH or else the unix epoch; setting $SOURCE_DATE_EPOCH alone also enables reproducible output")
+	composeCmd.PersistentFlags().StringVar(&c.composeFlags.sendOpts.Addr, "server", "", "smtp server address to send the message to")
+	composeCmd.PersistentFlags().StringVar(&c.composeFlags.sendOpts.Username, "username", "", "smtp auth username")
+	composeCmd.PersistentFlags().StringVar(&c.composeFlags.sendOpts.Password, "password", "", "smtp auth password")
+	composeCmd.PersistentFlags().StringVar(&c.composeFlags.sendOpts.From, "from", "", "smtp from, required to send")
+	composeCmd.PersistentFlags().StringVar(&c.composeFlags.sendOpts.To, "to", "", "smtp to, required to send")
+	composeCmd.PersistentFlags().StringVar(&c.composeFlags.sendOpts.DKIMSelector, "dkim-selector", "", "dkim selector")
+	composeCmd.PersistentFlags().StringVar(&c.composeFlags.sendOpts.DKIMKeyFile, "dkim-keyfile", "", "dkim key file (PEM)")
+	return composeCmd
+}
+
+func (c *Cmd) execComposeCmd(cmd *cobra.Command, args []string) {
+	if err := setDeterministic(cmd, &c.composeFlags.opts); err != nil {
+		c.logFatal(err)
+		return
+	}
+	// the envelope is checked before editing so that a draft is not lost to
+	// a failed send
+	if opts := c.composeFlags.sendOpts; opts.Addr != "" && (opts.From == "" || opts.To == "") {
+		c.logFatal(fmt.Errorf("%w: --server requires --from and --to", send.ErrInvalidArgs))
+		return
+	}
+	var draft []byte
+	if len(args) > 0 {
+		// the draft is read in full before the editor is opened
+		b, err := os.ReadFile(args[0])
+		if err != nil {
+			c.logFatal(err)
+			return
+		}
+		draft = b
+	}
+	r := bytes.NewReader(draft)
+	if c.composeFlags.sendOpts.Addr == "" {
+		if err := formatter.Compose(r, os.Stdout, c.composeFlags.opts); err != nil {
+			c.logFatal(err)
+			return
+		}
+		return
+	}
+	var b bytes.Buffer
+	if err := formatter.Compose(r, &b, c.composeFlags.opts); err != nil {
+		c.logFatal(err)
+		return
+	}
+	if err := send.Send(&b, c.composeFlags.sendOpts); err != nil {
+		c.logFatal(err)
+		return
+	}
+}
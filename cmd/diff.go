@@ -0,0 +1,39 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/spf13/cobra"
+	"xorkevin.dev/mailcat/inspect"
+)
+
+type (
+	diffFlags struct {
+		opts inspect.DiffOpts
+	}
+)
+
+func (c *Cmd) getDiffCmd() *cobra.Command {
+	diffCmd := &cobra.Command{
+		Use:   "diff a.eml b.eml",
+		Short: "Compares mail semantically",
+		Long: `Compares mail semantically
+
+Compares headers by their parsed values, such as address lists irrespective of
+order and dates as instants, and MIME parts by their decoded content rather
+than their encoding. Exits with a non-zero status if the messages differ.`,
+		Args:              cobra.ExactArgs(2),
+		Run:               c.execDiffCmd,
+		DisableAutoGenTag: true,
+	}
+	diffCmd.PersistentFlags().StringArrayVarP(&c.diffFlags.opts.Ignore, "ignore", "x", nil, "ignore headers matching a case insensitive glob (e.g. X-*); may be specified multiple times")
+	diffCmd.PersistentFlags().BoolVarP(&c.diffFlags.opts.IgnoreVolatile, "ignore-volatile", "v", false, "ignore headers that differ on every generated message (Message-ID, Content-ID, Date, DKIM-Signature, and Received)")
+	return diffCmd
+}
+
+func (c *Cmd) execDiffCmd(cmd *cobra.Command, args []string) {
+	if err := inspect.DiffFiles(args[0], args[1], os.Stdout, c.diffFlags.opts); err != nil {
+		c.logFatal(err)
+		return
+	}
+}
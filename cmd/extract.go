@@ -0,0 +1,40 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/spf13/cobra"
+	"xorkevin.dev/mailcat/inspect"
+)
+
+type (
+	extractFlags struct {
+		opts inspect.ExtractOpts
+	}
+)
+
+func (c *Cmd) getExtractCmd() *cobra.Command {
+	extractCmd := &cobra.Command{
+		Use:   "extract",
+		Short: "Extracts attachments and parts from mail",
+		Long: `Extracts attachments and parts from mail
+
+Reads a message from stdin and writes the decoded content of each attachment,
+and optionally each text part, to a file in the output dir, listing the part
+path and file of each. Alternatively writes the decoded content of a single
+part, numbered as in IMAP (e.g. 1.2), to stdout.`,
+		Run:               c.execExtractCmd,
+		DisableAutoGenTag: true,
+	}
+	extractCmd.PersistentFlags().StringVarP(&c.extractFlags.opts.Dir, "dir", "o", "", "output dir")
+	extractCmd.PersistentFlags().BoolVarP(&c.extractFlags.opts.Text, "text", "t", false, "also extract text parts")
+	extractCmd.PersistentFlags().StringVarP(&c.extractFlags.opts.Path, "part", "p", "", "part path to write to stdout")
+	return extractCmd
+}
+
+func (c *Cmd) execExtractCmd(cmd *cobra.Command, args []string) {
+	if err := inspect.Extract(os.Stdin, os.Stdout, c.extractFlags.opts); err != nil {
+		c.logFatal(err)
+		return
+	}
+}
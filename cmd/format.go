@@ -26,10 +26,30 @@ func (c *Cmd) getFormatCmd() *cobra.Command {
 	}
 	formatCmd.PersistentFlags().BoolVarP(&c.formatFlags.opts.CRLF, "crlf", "m", false, "output with CRLF line endings")
 	formatCmd.PersistentFlags().BoolVarP(&c.formatFlags.opts.Body, "body", "b", false, "input is body instead of a full RFC5322 message with headers")
+	formatCmd.PersistentFlags().BoolVarP(&c.formatFlags.opts.JSON, "json", "j", false, "input is a json object with from, to, cc, bcc, reply_to, subject, headers, text, html, and attachments fields instead of a RFC5322 message")
 	formatCmd.PersistentFlags().StringArrayVarP(&c.formatFlags.opts.Headers, "header", "s", nil, "set default header value (HEADER:VALUE); may be specified multiple times")
 	formatCmd.PersistentFlags().StringArrayVarP(&c.formatFlags.opts.AddHeaders, "add", "a", nil, "specify header values to be added (HEADER:VALUE); may be specified multiple times")
+	formatCmd.PersistentFlags().StringArrayVarP(&c.formatFlags.opts.Remove, "remove", "x", nil, "remove headers matching a case insensitive glob (e.g. X-*); may be specified multiple times")
+	formatCmd.PersistentFlags().StringArrayVarP(&c.formatFlags.opts.Replace, "replace", "w", nil, "override the values of headers matching a case insensitive glob (HEADER:VALUE), setting the header if none match; may be specified multiple times")
 	formatCmd.PersistentFlags().StringVarP(&c.formatFlags.opts.MsgIDDomain, "msgid", "y", "mail.example.com", "set default generated message id domain")
+	formatCmd.PersistentFlags().StringVar(&c.formatFlags.opts.ListID, "list-id", "", "set the List-Id header (e.g. \"News <news.example.com>\")")
+	formatCmd.PersistentFlags().StringVar(&c.formatFlags.opts.UnsubMailto, "unsubscribe-mailto", "", "mailto address or uri of the List-Unsubscribe header")
+	formatCmd.PersistentFlags().StringVar(&c.formatFlags.opts.UnsubURL, "unsubscribe-url", "", "https url of the List-Unsubscribe header, which also sets List-Unsubscribe-Post for one click unsubscribe")
 	formatCmd.PersistentFlags().BoolVarP(&c.formatFlags.opts.Edit, "edit", "e", false, "output in editor convenient format")
+	formatCmd.PersistentFlags().BoolVar(&c.formatFlags.opts.Reply, "reply", false, "output a reply to the input message quoting its body")
+	formatCmd.PersistentFlags().BoolVar(&c.formatFlags.opts.ReplyAll, "reply-all", false, "output a reply to the input message that is also sent to its recipients other than the From header address")
+	formatCmd.PersistentFlags().StringVar(&c.formatFlags.opts.Forward, "forward", "", "output a forward of the input message, either quoted inline (inline) or attached unchanged as message/rfc822 (attach)")
+	formatCmd.PersistentFlags().Lookup("forward").NoOptDefVal = formatter.ForwardInline
+	formatCmd.PersistentFlags().BoolVarP(&c.formatFlags.opts.Template, "template", "p", false, "render the input headers and body as a go text/template")
+	formatCmd.PersistentFlags().StringVarP(&c.formatFlags.opts.TemplateData, "data", "d", "", "json or yaml file of template data")
+	formatCmd.PersistentFlags().StringArrayVarP(&c.formatFlags.opts.Vars, "var", "r", nil, "set template data (key=value), overriding the data file; may be specified multiple times")
+	formatCmd.PersistentFlags().StringVarP(&c.formatFlags.opts.HTML, "html", "t", "", "html file to include as an alternative to the plaintext body in a multipart/alternative message")
+	formatCmd.PersistentFlags().BoolVarP(&c.formatFlags.opts.Markdown, "markdown", "k", false, "render the markdown body into a multipart/alternative message with an html part")
+	formatCmd.PersistentFlags().StringVar(&c.formatFlags.opts.CSS, "css", "", "css file to inline into rendered markdown (defaults to a built in stylesheet)")
+	formatCmd.PersistentFlags().StringArrayVarP(&c.formatFlags.opts.Inline, "inline", "l", nil, "inline a file (path[;type=TYPE;name=NAME]) in a multipart/related message with the html body, which may reference it by name; may be specified multiple times")
+	formatCmd.PersistentFlags().StringArrayVarP(&c.formatFlags.opts.Attachments, "attach", "f", nil, "attach a file (path[;type=TYPE;name=NAME]) in a multipart/mixed message; may be specified multiple times")
+	formatCmd.PersistentFlags().StringVar(&c.formatFlags.opts.Encoding, "encoding", "", "set the transfer encoding of every part (7bit, 8bit, quoted-printable, base64, or auto to use 7bit where possible and otherwise quoted-printable for text and base64 for other parts), which fails if a part cannot be sent with 7bit or 8bit")
+	formatCmd.PersistentFlags().Int64Var(&c.formatFlags.opts.Seed, "seed", 0, "seed generated Message-IDs, Content-IDs, and boundaries for reproducible output, with the Date from $SOURCE_DATE_EPOCH or else the unix epoch; setting $SOURCE_DATE_EPOCH alone also enables reproducible output")
 	formatCmd.PersistentFlags().BoolVarP(&c.formatFlags.empty, "empty", "z", false, "do not read from stdin and instead use empty reader")
 
 	return formatCmd
@@ -40,8 +60,29 @@ func (c *Cmd) execFormatCmd(cmd *cobra.Command, args []string) {
 	if c.formatFlags.empty {
 		r = bytes.NewReader(nil)
 	}
+	if err := setDeterministic(cmd, &c.formatFlags.opts); err != nil {
+		c.logFatal(err)
+		return
+	}
 	if err := formatter.Format(r, os.Stdout, c.formatFlags.opts); err != nil {
 		c.logFatal(err)
 		return
 	}
 }
+
+// setDeterministic enables reproducible output if a seed is provided or
+// $SOURCE_DATE_EPOCH is set
+func setDeterministic(cmd *cobra.Command, opts *formatter.Opts) error {
+	t, ok, err := formatter.SourceDateEpoch()
+	if err != nil {
+		return err
+	}
+	if ok {
+		opts.Deterministic = true
+		opts.Now = t
+	}
+	if cmd.Flags().Changed("seed") {
+		opts.Deterministic = true
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/spf13/cobra"
+	"xorkevin.dev/mailcat/inspect"
+)
+
+type (
+	inspectFlags struct {
+		opts inspect.Opts
+	}
+)
+
+func (c *Cmd) getInspectCmd() *cobra.Command {
+	inspectCmd := &cobra.Command{
+		Use:   "inspect",
+		Short: "Inspects the structure of mail",
+		Long: `Inspects the structure of mail
+
+Reads a message from stdin and prints its decoded headers, its MIME tree of
+content types, charsets, transfer encodings, dispositions, filenames, and
+decoded sizes, and warnings for structural problems. Parts are numbered as in
+IMAP.
+
+With --decode, the message is instead written with the transfer encoding of
+every part decoded.`,
+		Run:               c.execInspectCmd,
+		DisableAutoGenTag: true,
+	}
+	inspectCmd.PersistentFlags().BoolVarP(&c.inspectFlags.opts.JSON, "json", "j", false, "output json")
+	inspectCmd.PersistentFlags().BoolVar(&c.inspectFlags.opts.Decode, "decode", false, "output the message with the transfer encoding of every part decoded")
+	return inspectCmd
+}
+
+func (c *Cmd) execInspectCmd(cmd *cobra.Command, args []string) {
+	if err := inspect.Inspect(os.Stdin, os.Stdout, c.inspectFlags.opts); err != nil {
+		c.logFatal(err)
+		return
+	}
+}
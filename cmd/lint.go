@@ -0,0 +1,42 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/spf13/cobra"
+	"xorkevin.dev/mailcat/lint"
+)
+
+type (
+	lintFlags struct {
+		opts   lint.Opts
+		failOn string
+	}
+)
+
+func (c *Cmd) getLintCmd() *cobra.Command {
+	lintCmd := &cobra.Command{
+		Use:   "lint",
+		Short: "Checks mail for RFC 5322 and MIME compliance",
+		Long: `Checks mail for RFC 5322 and MIME compliance
+
+Reads a message from stdin and reports every problem found with its rule id,
+severity, and location. Exits with a non-zero status if any problem is at
+least as severe as the fail on severity (error, warning, info, or none).`,
+		Run:               c.execLintCmd,
+		DisableAutoGenTag: true,
+	}
+	lintCmd.PersistentFlags().BoolVarP(&c.lintFlags.opts.JSON, "json", "j", false, "output json")
+	lintCmd.PersistentFlags().BoolVarP(&c.lintFlags.opts.CRLF, "crlf", "m", false, "require CRLF line endings")
+	lintCmd.PersistentFlags().BoolVar(&c.lintFlags.opts.Bulk, "bulk", false, "check list headers required of bulk mail even if the message does not have a bulk Precedence or list headers")
+	lintCmd.PersistentFlags().StringVar(&c.lintFlags.failOn, "fail-on", string(lint.SeverityError), "minimum severity of problems to fail on")
+	return lintCmd
+}
+
+func (c *Cmd) execLintCmd(cmd *cobra.Command, args []string) {
+	c.lintFlags.opts.FailOn = lint.Severity(c.lintFlags.failOn)
+	if err := lint.Lint(os.Stdin, os.Stdout, c.lintFlags.opts); err != nil {
+		c.logFatal(err)
+		return
+	}
+}
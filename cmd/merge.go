@@ -0,0 +1,69 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/spf13/cobra"
+	"xorkevin.dev/mailcat/merge"
+)
+
+type (
+	mergeFlags struct {
+		opts merge.Opts
+	}
+)
+
+func (c *Cmd) getMergeCmd() *cobra.Command {
+	mergeCmd := &cobra.Command{
+		Use:   "merge csvfile",
+		Short: "Formats a templated message per csv row",
+		Long: `Formats a templated message per csv row
+
+Renders the message template read from stdin as a go text/template once per
+row of the csv file, with the columns named by the csv header row as template
+data. Each message is formatted with its own Message-ID and Date.
+
+Messages are written to a directory, appended to an mbox, or sent over a single
+smtp session if a server is provided, and otherwise are written to stdout as an
+mbox.`,
+		Args:              cobra.ExactArgs(1),
+		Run:               c.execMergeCmd,
+		DisableAutoGenTag: true,
+	}
+	mergeCmd.PersistentFlags().BoolVarP(&c.mergeFlags.opts.Format.CRLF, "crlf", "m", false, "output with CRLF line endings")
+	mergeCmd.PersistentFlags().StringArrayVarP(&c.mergeFlags.opts.Format.Headers, "header", "s", nil, "set default header value (HEADER:VALUE); may be specified multiple times")
+	mergeCmd.PersistentFlags().StringArrayVarP(&c.mergeFlags.opts.Format.AddHeaders, "add", "a", nil, "specify header values to be added (HEADER:VALUE); may be specified multiple times")
+	mergeCmd.PersistentFlags().StringVarP(&c.mergeFlags.opts.Format.MsgIDDomain, "msgid", "y", "mail.example.com", "set default generated message id domain")
+	mergeCmd.PersistentFlags().StringVar(&c.mergeFlags.opts.Format.ListID, "list-id", "", "set the List-Id header (e.g. \"News <news.example.com>\")")
+	mergeCmd.PersistentFlags().StringVar(&c.mergeFlags.opts.Format.UnsubMailto, "unsubscribe-mailto", "", "mailto address or uri of the List-Unsubscribe header")
+	mergeCmd.PersistentFlags().StringVar(&c.mergeFlags.opts.Format.UnsubURL, "unsubscribe-url", "", "https url of the List-Unsubscribe header, which also sets List-Unsubscribe-Post for one click unsubscribe")
+	mergeCmd.PersistentFlags().StringVarP(&c.mergeFlags.opts.Format.TemplateData, "data", "d", "", "json or yaml file of template data shared by every row")
+	mergeCmd.PersistentFlags().StringArrayVarP(&c.mergeFlags.opts.Format.Vars, "var", "r", nil, "set template data (key=value) shared by every row, overriding the data file; may be specified multiple times")
+	mergeCmd.PersistentFlags().BoolVarP(&c.mergeFlags.opts.Format.Markdown, "markdown", "k", false, "render the markdown body into a multipart/alternative message with an html part")
+	mergeCmd.PersistentFlags().StringVar(&c.mergeFlags.opts.Format.CSS, "css", "", "css file to inline into rendered markdown (defaults to a built in stylesheet)")
+	mergeCmd.PersistentFlags().StringArrayVarP(&c.mergeFlags.opts.Format.Attachments, "attach", "f", nil, "attach a file (path[;type=TYPE;name=NAME]) in a multipart/mixed message; may be specified multiple times")
+	mergeCmd.PersistentFlags().StringVar(&c.mergeFlags.opts.Format.Encoding, "encoding", "", "set the transfer encoding of every part (7bit, 8bit, quoted-printable, base64, or auto to use 7bit where possible and otherwise quoted-printable for text and base64 for other parts), which fails if a part cannot be sent with 7bit or 8bit")
+	mergeCmd.PersistentFlags().Int64Var(&c.mergeFlags.opts.Format.Seed, "seed", 0, "seed generated Message-IDs, Content-IDs, and boundaries for reproducible output, offset by the csv line of each row, with the Date from $SOURCE_DATE_EPOCH or else the unix epoch; setting $SOURCE_DATE_EPOCH alone also enables reproducible output")
+	mergeCmd.PersistentFlags().StringVarP(&c.mergeFlags.opts.Dir, "dir", "o", "", "directory to write a message file per row to")
+	mergeCmd.PersistentFlags().StringVarP(&c.mergeFlags.opts.Mbox, "mbox", "x", "", "mbox to append messages to")
+	mergeCmd.PersistentFlags().StringVar(&c.mergeFlags.opts.Send.Addr, "server", "", "smtp server address to send messages to")
+	mergeCmd.PersistentFlags().StringVar(&c.mergeFlags.opts.Send.Username, "username", "", "smtp auth username")
+	mergeCmd.PersistentFlags().StringVar(&c.mergeFlags.opts.Send.Password, "password", "", "smtp auth password")
+	mergeCmd.PersistentFlags().StringVar(&c.mergeFlags.opts.Send.From, "from", "", "smtp from (defaults to the From header address)")
+	mergeCmd.PersistentFlags().StringVar(&c.mergeFlags.opts.Send.To, "to", "", "smtp to (defaults to the To, Cc, and Bcc header addresses)")
+	mergeCmd.PersistentFlags().StringVar(&c.mergeFlags.opts.Send.DKIMSelector, "dkim-selector", "", "dkim selector")
+	mergeCmd.PersistentFlags().StringVar(&c.mergeFlags.opts.Send.DKIMKeyFile, "dkim-keyfile", "", "dkim key file (PEM)")
+	return mergeCmd
+}
+
+func (c *Cmd) execMergeCmd(cmd *cobra.Command, args []string) {
+	c.mergeFlags.opts.CSV = args[0]
+	if err := setDeterministic(cmd, &c.mergeFlags.opts.Format); err != nil {
+		c.logFatal(err)
+		return
+	}
+	if err := merge.Merge(os.Stdin, os.Stdout, c.mergeFlags.opts); err != nil {
+		c.logFatal(err)
+		return
+	}
+}
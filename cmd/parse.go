@@ -0,0 +1,31 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/spf13/cobra"
+	"xorkevin.dev/mailcat/inspect"
+)
+
+func (c *Cmd) getParseCmd() *cobra.Command {
+	parseCmd := &cobra.Command{
+		Use:   "parse",
+		Short: "Parses mail into json",
+		Long: `Parses mail into json
+
+Reads a message from stdin and writes json with its parsed address lists,
+decoded subject, Message-ID, In-Reply-To, and References, date as RFC 3339,
+decoded headers, text and html bodies, and the non-multipart parts with the
+decoded content of text parts.`,
+		Run:               c.execParseCmd,
+		DisableAutoGenTag: true,
+	}
+	return parseCmd
+}
+
+func (c *Cmd) execParseCmd(cmd *cobra.Command, args []string) {
+	if err := inspect.Parse(os.Stdin, os.Stdout); err != nil {
+		c.logFatal(err)
+		return
+	}
+}
@@ -9,12 +9,19 @@ import (
 
 type (
 	Cmd struct {
-		rootCmd     *cobra.Command
-		version     string
-		rootFlags   rootFlags
-		formatFlags formatFlags
-		sendFlags   sendFlags
-		docFlags    docFlags
+		rootCmd      *cobra.Command
+		version      string
+		rootFlags    rootFlags
+		formatFlags  formatFlags
+		composeFlags composeFlags
+		sendFlags    sendFlags
+		benchFlags   benchFlags
+		mergeFlags   mergeFlags
+		inspectFlags inspectFlags
+		extractFlags extractFlags
+		lintFlags    lintFlags
+		diffFlags    diffFlags
+		docFlags     docFlags
 	}
 
 	rootFlags struct {
@@ -39,7 +46,15 @@ func (c *Cmd) Execute() {
 	c.rootCmd = rootCmd
 
 	rootCmd.AddCommand(c.getFormatCmd())
+	rootCmd.AddCommand(c.getComposeCmd())
+	rootCmd.AddCommand(c.getMergeCmd())
 	rootCmd.AddCommand(c.getSendCmd())
+	rootCmd.AddCommand(c.getBenchCmd())
+	rootCmd.AddCommand(c.getInspectCmd())
+	rootCmd.AddCommand(c.getExtractCmd())
+	rootCmd.AddCommand(c.getParseCmd())
+	rootCmd.AddCommand(c.getDiffCmd())
+	rootCmd.AddCommand(c.getLintCmd())
 	rootCmd.AddCommand(c.getDocCmd())
 
 	if err := rootCmd.Execute(); err != nil {
@@ -1,15 +1,20 @@
 package cmd
 
 import (
+	"fmt"
 	"os"
+	"time"
 
 	"github.com/spf13/cobra"
 	"xorkevin.dev/mailcat/send"
+	"xorkevin.dev/mailcat/verify"
 )
 
 type (
 	sendFlags struct {
 		opts             send.Opts
+		verifyOpts       verify.Opts
+		dryRun           bool
 		sendAddr         string
 		sendUsername     string
 		sendPassword     string
@@ -22,23 +27,97 @@ type (
 
 func (c *Cmd) getSendCmd() *cobra.Command {
 	sendCmd := &cobra.Command{
-		Use:               "send",
-		Short:             "Sends smtp mail",
-		Long:              `Sends smtp mail`,
+		Use:   "send [path ...]",
+		Short: "Sends smtp mail",
+		Long: `Sends smtp mail
+
+Sends a single message read from stdin. If paths to message files, mboxes, or
+directories of either are provided instead, all messages are sent over a single
+smtp session.
+
+If a verify server is provided, the mailbox is polled after sending until the
+message is found, and the delivery latency and mailbox are reported. Verify is
+only supported when sending a single message read from stdin.`,
 		Run:               c.execSendCmd,
 		DisableAutoGenTag: true,
 	}
 	sendCmd.PersistentFlags().StringVarP(&c.sendFlags.opts.Addr, "server", "s", "", "smtp server address")
 	sendCmd.PersistentFlags().StringVarP(&c.sendFlags.opts.Username, "username", "u", "", "smtp auth username")
 	sendCmd.PersistentFlags().StringVarP(&c.sendFlags.opts.Password, "password", "a", "", "smtp auth password")
-	sendCmd.PersistentFlags().StringVarP(&c.sendFlags.opts.From, "from", "i", "", "smtp from")
-	sendCmd.PersistentFlags().StringVarP(&c.sendFlags.opts.To, "to", "o", "", "smtp to")
+	sendCmd.PersistentFlags().StringVarP(&c.sendFlags.opts.From, "from", "i", "", "smtp from, required when sending from stdin (defaults to the From header address for message paths)")
+	sendCmd.PersistentFlags().StringVarP(&c.sendFlags.opts.To, "to", "o", "", "smtp to, required when sending from stdin (defaults to the To, Cc, and Bcc header addresses for message paths)")
 	sendCmd.PersistentFlags().StringVar(&c.sendFlags.opts.DKIMSelector, "dkim-selector", "", "dkim selector")
 	sendCmd.PersistentFlags().StringVar(&c.sendFlags.opts.DKIMKeyFile, "dkim-keyfile", "", "dkim key file (PEM)")
+	sendCmd.PersistentFlags().BoolVar(&c.sendFlags.dryRun, "dry-run", false, "print the smtp envelope and signed message instead of sending")
+	sendCmd.PersistentFlags().StringVar(&c.sendFlags.verifyOpts.Addr, "verify-server", "", "imap or pop3 server address (implicit tls) to verify delivery of the sent message")
+	sendCmd.PersistentFlags().StringVar(&c.sendFlags.verifyOpts.Proto, "verify-proto", verify.ProtoIMAP, "verify protocol (imap or pop3)")
+	sendCmd.PersistentFlags().StringVar(&c.sendFlags.verifyOpts.Username, "verify-username", "", "verify auth username")
+	sendCmd.PersistentFlags().StringVar(&c.sendFlags.verifyOpts.Password, "verify-password", "", "verify auth password")
+	sendCmd.PersistentFlags().StringArrayVar(&c.sendFlags.verifyOpts.Mailboxes, "verify-mailbox", nil, "imap mailbox to search (defaults to the inbox and spam mailboxes), which pop3 does not support; may be specified multiple times")
+	sendCmd.PersistentFlags().DurationVar(&c.sendFlags.verifyOpts.Timeout, "verify-timeout", 5*time.Minute, "time to wait for the message to be delivered")
+	sendCmd.PersistentFlags().DurationVar(&c.sendFlags.verifyOpts.Interval, "verify-interval", 5*time.Second, "interval between mailbox polls")
+	sendCmd.PersistentFlags().BoolVar(&c.sendFlags.verifyOpts.Delete, "verify-delete", false, "delete the message once it is delivered")
 	return sendCmd
 }
 
+// verifyFlags are the flags of the verify step of a single message send
+var verifyFlags = []string{
+	"verify-server",
+	"verify-proto",
+	"verify-username",
+	"verify-password",
+	"verify-mailbox",
+	"verify-timeout",
+	"verify-interval",
+	"verify-delete",
+}
+
 func (c *Cmd) execSendCmd(cmd *cobra.Command, args []string) {
+	for _, i := range verifyFlags {
+		if !cmd.Flags().Changed(i) {
+			continue
+		}
+		if c.sendFlags.dryRun {
+			c.logFatal(fmt.Errorf("%w: --%s may not be used with --dry-run", verify.ErrInvalidArgs, i))
+			return
+		}
+		if len(args) > 0 {
+			c.logFatal(fmt.Errorf("%w: --%s may not be used when sending message paths", verify.ErrInvalidArgs, i))
+			return
+		}
+		if c.sendFlags.verifyOpts.Addr == "" {
+			c.logFatal(fmt.Errorf("%w: --%s requires --verify-server", verify.ErrInvalidArgs, i))
+			return
+		}
+	}
+	if c.sendFlags.dryRun {
+		if len(args) > 0 {
+			if err := send.DryRunBatch(args, os.Stdout, c.sendFlags.opts); err != nil {
+				c.logFatal(err)
+				return
+			}
+			return
+		}
+		if err := send.DryRun(os.Stdin, os.Stdout, c.sendFlags.opts); err != nil {
+			c.logFatal(err)
+			return
+		}
+		return
+	}
+	if len(args) > 0 {
+		if err := send.SendBatch(args, c.sendFlags.opts); err != nil {
+			c.logFatal(err)
+			return
+		}
+		return
+	}
+	if c.sendFlags.verifyOpts.Addr != "" {
+		if err := verify.Send(os.Stdin, os.Stdout, c.sendFlags.opts, c.sendFlags.verifyOpts); err != nil {
+			c.logFatal(err)
+			return
+		}
+		return
+	}
 	if err := send.Send(os.Stdin, c.sendFlags.opts); err != nil {
 		c.logFatal(err)
 		return
@@ -0,0 +1,452 @@
+package formatter
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/emersion/go-message"
+	"golang.org/x/net/html"
+)
+
+type (
+	// Attachment is a file to be attached to a message
+	Attachment struct {
+		Path        string
+		ContentType string
+		Name        string
+		// Content is the content of the attachment instead of the file at
+		// Path if not nil
+		Content []byte
+	}
+
+	inlinePart struct {
+		refs []string
+		cid  string
+		e    *message.Entity
+	}
+
+	// fileReader opens a file on first read and closes it at EOF, so that
+	// attachments are streamed when the message is written
+	fileReader struct {
+		name string
+		f    *os.File
+		done bool
+	}
+)
+
+var (
+	ErrInvalidAttachment = errors.New("Invalid attachment")
+)
+
+const (
+	headerContentTransferEncoding = "Content-Transfer-Encoding"
+	headerContentDisposition      = "Content-Disposition"
+	headerContentID               = "Content-Id"
+
+	headerContentPrefix = "Content-"
+)
+
+const (
+	contentTypeMultipartMixed       = "multipart/mixed"
+	contentTypeMultipartAlternative = "multipart/alternative"
+	contentTypeMultipartRelated     = "multipart/related"
+	contentTypeTextHTML             = "text/html"
+
+	dispositionAttachment = "attachment"
+	dispositionInline     = "inline"
+
+	encodingBase64          = "base64"
+	encodingQuotedPrintable = "quoted-printable"
+
+	paramCharset  = "charset"
+	paramType     = "type"
+	paramBoundary = "boundary"
+	paramName     = "name"
+	paramFilename = "filename"
+
+	charsetUTF8 = "utf-8"
+
+	sniffLen = 512
+)
+
+// ParseAttachment parses an attachment of the form path[;type=...;name=...]
+func ParseAttachment(s string) (Attachment, error) {
+	parts := strings.Split(s, ";")
+	a := Attachment{
+		Path: strings.TrimSpace(parts[0]),
+	}
+	if a.Path == "" {
+		return Attachment{}, fmt.Errorf("%w: no path: %s", ErrInvalidAttachment, s)
+	}
+	for _, i := range parts[1:] {
+		k, v, ok := strings.Cut(i, "=")
+		if !ok {
+			return Attachment{}, fmt.Errorf("%w: invalid option %s: %s", ErrInvalidAttachment, i, s)
+		}
+		v = strings.TrimSpace(v)
+		switch strings.ToLower(strings.TrimSpace(k)) {
+		case "type":
+			a.ContentType = v
+		case "name":
+			a.Name = v
+		default:
+			return Attachment{}, fmt.Errorf("%w: unknown option %s: %s", ErrInvalidAttachment, k, s)
+		}
+	}
+	return a, nil
+}
+
+// openFile returns a reader that streams a file when the message is written
+func openFile(name string) (io.Reader, error) {
+	if info, err := os.Stat(name); err != nil {
+		return nil, fmt.Errorf("Failed to stat file %s: %w", name, err)
+	} else if !info.Mode().IsRegular() {
+		return nil, fmt.Errorf("Not a regular file: %s", name)
+	}
+	return &fileReader{
+		name: name,
+	}, nil
+}
+
+func (r *fileReader) Read(p []byte) (int, error) {
+	if r.done {
+		return 0, io.EOF
+	}
+	if r.f == nil {
+		f, err := os.Open(r.name)
+		if err != nil {
+			r.done = true
+			return 0, fmt.Errorf("Failed to open file %s: %w", r.name, err)
+		}
+		r.f = f
+	}
+	n, err := r.f.Read(p)
+	if err != nil {
+		r.done = true
+		if cerr := r.f.Close(); cerr != nil {
+			return n, errors.Join(err, fmt.Errorf("Failed closing file %s: %w", r.name, cerr))
+		}
+		if !errors.Is(err, io.EOF) {
+			return n, fmt.Errorf("Failed reading file %s: %w", r.name, err)
+		}
+	}
+	return n, err
+}
+
+// detectContentType determines the media type of a file from its extension,
+// falling back to sniffing its content
+func detectContentType(name string) (_ string, retErr error) {
+	if t := mime.TypeByExtension(filepath.Ext(name)); t != "" {
+		return t, nil
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		return "", fmt.Errorf("Failed to open file %s: %w", name, err)
+	}
+	defer func() {
+		if err := f.Close(); err != nil {
+			retErr = errors.Join(retErr, fmt.Errorf("Failed closing file %s: %w", name, err))
+		}
+	}()
+	b := make([]byte, sniffLen)
+	n, err := io.ReadFull(f, b)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return "", fmt.Errorf("Failed reading file %s: %w", name, err)
+	}
+	return http.DetectContentType(b[:n]), nil
+}
+
+// newEntity creates an entity from an already decoded body, since
+// [message.New] would otherwise decode the body with the header transfer
+// encoding
+func newEntity(h message.Header, body io.Reader) (*message.Entity, error) {
+	h = h.Copy()
+	enc := h.Get(headerContentTransferEncoding)
+	h.Del(headerContentTransferEncoding)
+	e, err := message.New(h, body)
+	if err != nil {
+		return nil, fmt.Errorf("Failed creating mail message part: %w", err)
+	}
+	if enc != "" {
+		e.Header.Set(headerContentTransferEncoding, enc)
+	}
+	return e, nil
+}
+
+// newFilePart creates a base64 encoded part from a file with the content
+// disposition disp
+func newFilePart(a Attachment, disp string) (*message.Entity, error) {
+	name := a.Name
+	if name == "" && a.Path != "" {
+		name = filepath.Base(a.Path)
+	}
+	if name == "" {
+		return nil, fmt.Errorf("%w: no name", ErrInvalidAttachment)
+	}
+	var body io.Reader
+	ct := a.ContentType
+	if a.Content != nil {
+		body = bytes.NewReader(a.Content)
+		if ct == "" {
+			ct = mime.TypeByExtension(filepath.Ext(name))
+		}
+		if ct == "" {
+			ct = http.DetectContentType(a.Content)
+		}
+	} else {
+		r, err := openFile(a.Path)
+		if err != nil {
+			return nil, err
+		}
+		body = r
+		if ct == "" {
+			t, err := detectContentType(a.Path)
+			if err != nil {
+				return nil, err
+			}
+			ct = t
+		}
+	}
+	t, params, err := mime.ParseMediaType(ct)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid type %s: %w", ErrInvalidAttachment, ct, err)
+	}
+	if strings.HasPrefix(t, "multipart/") {
+		return nil, fmt.Errorf("%w: multipart type %s", ErrInvalidAttachment, t)
+	}
+	params[paramName] = name
+	var h message.Header
+	// parameters are formatted directly rather than with
+	// [message.Header.SetContentType] in order to encode non-ascii names per
+	// RFC 2231 instead of RFC 2047
+	h.Set(headerContentType, mime.FormatMediaType(t, params))
+	h.Set(headerContentDisposition, mime.FormatMediaType(disp, map[string]string{
+		paramFilename: name,
+	}))
+	h.Set(headerContentTransferEncoding, encodingBase64)
+	return newEntity(h, body)
+}
+
+func (f *formatter) AddInline(a Attachment, msgidDomain string) error {
+	if f.m == nil {
+		return ErrNoMsg
+	}
+	e, err := newFilePart(a, dispositionInline)
+	if err != nil {
+		return err
+	}
+	cid, err := f.genMsgID(msgidDomain)
+	if err != nil {
+		return err
+	}
+	e.Header.Set(headerContentID, "<"+cid+">")
+	name := a.Name
+	if name == "" {
+		name = filepath.Base(a.Path)
+	}
+	refs := []string{name}
+	if a.Path != "" {
+		refs = append(refs, a.Path)
+	}
+	f.inline = append(f.inline, inlinePart{
+		refs: refs,
+		cid:  cid,
+		e:    e,
+	})
+	return nil
+}
+
+// relateHTML rewrites references in the html to inline parts by their
+// filename to cid urls, and returns the html and inline parts in a
+// multipart/related container
+func (f *formatter) relateHTML() (*message.Entity, error) {
+	doc, err := io.ReadAll(f.html.Body)
+	if err != nil {
+		return nil, fmt.Errorf("Failed reading html: %w", err)
+	}
+	cids := map[string]string{}
+	for _, i := range f.inline {
+		for _, j := range i.refs {
+			if _, ok := cids[j]; !ok {
+				cids[j] = "cid:" + i.cid
+			}
+		}
+	}
+	doc, err = rewriteHTML(doc, func(t *html.Token) bool {
+		modified := false
+		for _, i := range []string{attrSrc, attrBackground} {
+			if v, ok := tokenAttr(t, i); ok {
+				if cid, ok := cids[v]; ok {
+					setTokenAttr(t, i, cid)
+					modified = true
+				}
+			}
+		}
+		return modified
+	})
+	if err != nil {
+		return nil, err
+	}
+	htmlPart, err := newEntity(f.html.Header, bytes.NewReader(doc))
+	if err != nil {
+		return nil, err
+	}
+	parts := make([]*message.Entity, 0, 1+len(f.inline))
+	parts = append(parts, htmlPart)
+	for _, i := range f.inline {
+		parts = append(parts, i.e)
+	}
+	f.inline = nil
+	var h message.Header
+	boundary, err := f.genBoundary()
+	if err != nil {
+		return nil, err
+	}
+	h.SetContentType(contentTypeMultipartRelated, map[string]string{
+		paramType:     contentTypeTextHTML,
+		paramBoundary: boundary,
+	})
+	m, err := message.NewMultipart(h, parts)
+	if err != nil {
+		return nil, fmt.Errorf("Failed creating multipart mail message: %w", err)
+	}
+	return m, nil
+}
+
+func (f *formatter) AddAttachment(a Attachment) error {
+	if f.m == nil {
+		return ErrNoMsg
+	}
+	e, err := newFilePart(a, dispositionAttachment)
+	if err != nil {
+		return err
+	}
+	f.attachments = append(f.attachments, e)
+	return nil
+}
+
+// splitContent separates the content headers of the message into a part of
+// its own, leaving the message headers
+func (f *formatter) splitContent() (*message.Entity, error) {
+	var keys, values []string
+	fields := f.m.Header.Fields()
+	for fields.Next() {
+		if strings.HasPrefix(fields.Key(), headerContentPrefix) {
+			keys = append(keys, fields.Key())
+			values = append(values, fields.Value())
+			fields.Del()
+		}
+	}
+	var content message.Header
+	// headers are prepended, so add in reverse to preserve order
+	for i := len(keys) - 1; i >= 0; i-- {
+		content.Add(keys[i], values[i])
+	}
+	if !content.Has(headerContentType) {
+		content.SetContentType(contentTypeTextPlain, map[string]string{
+			paramCharset: charsetUTF8,
+		})
+	}
+	return newEntity(content, f.m.Body)
+}
+
+// newMultipart creates a multipart entity of type t with the headers h
+func (f *formatter) newMultipart(h message.Header, t string, parts []*message.Entity) (*message.Entity, error) {
+	boundary, err := f.genBoundary()
+	if err != nil {
+		return nil, err
+	}
+	h = h.Copy()
+	h.SetContentType(t, map[string]string{
+		paramBoundary: boundary,
+	})
+	m, err := message.NewMultipart(h, parts)
+	if err != nil {
+		return nil, fmt.Errorf("Failed creating multipart mail message: %w", err)
+	}
+	return m, nil
+}
+
+func (f *formatter) SetHTML(r io.Reader) error {
+	if f.m == nil {
+		return ErrNoMsg
+	}
+	if f.html != nil {
+		return fmt.Errorf("%w: multiple html bodies", ErrInvalidBody)
+	}
+	var h message.Header
+	h.SetContentType(contentTypeTextHTML, map[string]string{
+		paramCharset: charsetUTF8,
+	})
+	// html is commonly minified into lines longer than smtp allows
+	h.Set(headerContentTransferEncoding, encodingQuotedPrintable)
+	e, err := newEntity(h, r)
+	if err != nil {
+		return err
+	}
+	f.html = e
+	return nil
+}
+
+// compose builds the multipart structure of the message from its added parts
+//
+//	multipart/mixed
+//	|- multipart/alternative
+//	|  |- text/plain
+//	|  |- multipart/related
+//	|     |- text/html
+//	|     |- inline images
+//	|- attachments
+func (f *formatter) compose() error {
+	if len(f.inline) > 0 && f.html == nil {
+		return fmt.Errorf("%w: inline parts require an html body", ErrInvalidBody)
+	}
+	if f.html == nil && len(f.attachments) == 0 {
+		return nil
+	}
+	body, err := f.splitContent()
+	if err != nil {
+		return err
+	}
+	if f.html != nil {
+		htmlPart := f.html
+		if len(f.inline) > 0 {
+			m, err := f.relateHTML()
+			if err != nil {
+				return err
+			}
+			htmlPart = m
+		}
+		parts := []*message.Entity{body, htmlPart}
+		f.html = nil
+		if len(f.attachments) == 0 {
+			m, err := f.newMultipart(f.m.Header, contentTypeMultipartAlternative, parts)
+			if err != nil {
+				return err
+			}
+			f.m = m
+			return nil
+		}
+		body, err = f.newMultipart(message.Header{}, contentTypeMultipartAlternative, parts)
+		if err != nil {
+			return err
+		}
+	}
+	parts := make([]*message.Entity, 0, 1+len(f.attachments))
+	parts = append(parts, body)
+	parts = append(parts, f.attachments...)
+	f.attachments = nil
+	m, err := f.newMultipart(f.m.Header, contentTypeMultipartMixed, parts)
+	if err != nil {
+		return err
+	}
+	f.m = m
+	return nil
+}
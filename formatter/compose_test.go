@@ -0,0 +1,220 @@
+package formatter
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/emersion/go-message"
+	"github.com/stretchr/testify/require"
+)
+
+type (
+	// composedPart is a part of a composed message read back for testing
+	composedPart struct {
+		Path        []int
+		ContentType string
+		Encoding    string
+		Body        string
+		e           *message.Entity
+	}
+)
+
+// composeMsg writes the message of a formatter and reads back its parts in
+// pre-order
+func composeMsg(t *testing.T, f *formatter) []composedPart {
+	t.Helper()
+	assert := require.New(t)
+
+	var b bytes.Buffer
+	assert.NoError(f.WriteMsg(&b, true))
+	m, err := message.Read(bytes.NewReader(b.Bytes()))
+	assert.NoError(err)
+	var parts []composedPart
+	assert.NoError(m.Walk(func(path []int, e *message.Entity, err error) error {
+		if err != nil {
+			return err
+		}
+		t, _, err := e.Header.ContentType()
+		if err != nil {
+			return err
+		}
+		p := composedPart{
+			Path:        append([]int(nil), path...),
+			ContentType: t,
+			Encoding:    e.Header.Get(headerContentTransferEncoding),
+			e:           e,
+		}
+		if !strings.HasPrefix(t, "multipart/") {
+			body, err := io.ReadAll(e.Body)
+			if err != nil {
+				return err
+			}
+			p.Body = string(body)
+		}
+		parts = append(parts, p)
+		return nil
+	}))
+	return parts
+}
+
+func Test_AddAttachment(t *testing.T) {
+	t.Parallel()
+
+	assert := require.New(t)
+
+	dir := t.TempDir()
+	notes := filepath.Join(dir, "notes.txt")
+	assert.NoError(os.WriteFile(notes, []byte("hello\n"), 0o644))
+
+	f := New().(*formatter)
+	assert.NoError(f.ReadMsg(strings.NewReader("From: alice@example.com\nSubject: lunch\n\nhi\n")))
+	assert.NoError(f.AddAttachment(Attachment{
+		Path: notes,
+	}))
+	assert.NoError(f.AddAttachment(Attachment{
+		Name:        "café menu.pdf",
+		ContentType: "application/pdf",
+		Content:     []byte("%PDF"),
+	}))
+	parts := composeMsg(t, f)
+	assert.Len(parts, 4)
+
+	assert.Equal(contentTypeMultipartMixed, parts[0].ContentType)
+	assert.Equal("alice@example.com", parts[0].e.Header.Get(headerFrom))
+
+	assert.Equal([]int{0}, parts[1].Path)
+	assert.Equal(contentTypeTextPlain, parts[1].ContentType)
+	assert.Equal("hi\r\n", parts[1].Body)
+
+	assert.Equal([]int{1}, parts[2].Path)
+	assert.Equal("text/plain", parts[2].ContentType)
+	assert.Equal(encodingBase64, parts[2].Encoding)
+	assert.Equal("hello\n", parts[2].Body)
+	disp, dispParams, err := parts[2].e.Header.ContentDisposition()
+	assert.NoError(err)
+	assert.Equal(dispositionAttachment, disp)
+	assert.Equal("notes.txt", dispParams[paramFilename])
+
+	assert.Equal([]int{2}, parts[3].Path)
+	assert.Equal("application/pdf", parts[3].ContentType)
+	assert.Equal(encodingBase64, parts[3].Encoding)
+	assert.Equal("%PDF", parts[3].Body)
+	// non-ascii names are encoded per RFC 2231 rather than RFC 2047
+	assert.Equal(`application/pdf; name*=utf-8''caf%C3%A9%20menu.pdf`, parts[3].e.Header.Get(headerContentType))
+	assert.Equal(`attachment; filename*=utf-8''caf%C3%A9%20menu.pdf`, parts[3].e.Header.Get(headerContentDisposition))
+	_, params, err := parts[3].e.Header.ContentType()
+	assert.NoError(err)
+	assert.Equal("café menu.pdf", params[paramName])
+	_, dispParams, err = parts[3].e.Header.ContentDisposition()
+	assert.NoError(err)
+	assert.Equal("café menu.pdf", dispParams[paramFilename])
+}
+
+func Test_SetHTML(t *testing.T) {
+	t.Parallel()
+
+	doc := "<p>" + strings.Repeat("a", 1000) + "</p>"
+
+	for _, tc := range []struct {
+		Name     string
+		Attach   bool
+		Types    []string
+		Paths    [][]int
+		HTMLPart int
+	}{
+		{
+			Name:     "Alternative at the top level",
+			Types:    []string{contentTypeMultipartAlternative, contentTypeTextPlain, contentTypeTextHTML},
+			Paths:    [][]int{nil, {0}, {1}},
+			HTMLPart: 2,
+		},
+		{
+			Name:     "Alternative nested in mixed with attachments",
+			Attach:   true,
+			Types:    []string{contentTypeMultipartMixed, contentTypeMultipartAlternative, contentTypeTextPlain, contentTypeTextHTML, "text/plain"},
+			Paths:    [][]int{nil, {0}, {0, 0}, {0, 1}, {1}},
+			HTMLPart: 3,
+		},
+	} {
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			assert := require.New(t)
+
+			f := New().(*formatter)
+			assert.NoError(f.ReadMsg(strings.NewReader("From: alice@example.com\nSubject: lunch\n\nhi\n")))
+			assert.NoError(f.SetHTML(strings.NewReader(doc)))
+			if tc.Attach {
+				assert.NoError(f.AddAttachment(Attachment{
+					Name:    "notes.txt",
+					Content: []byte("hello\n"),
+				}))
+			}
+			parts := composeMsg(t, f)
+			var types []string
+			var paths [][]int
+			for _, i := range parts {
+				types = append(types, i.ContentType)
+				paths = append(paths, i.Path)
+			}
+			assert.Equal(tc.Types, types)
+			assert.Equal(tc.Paths, paths)
+			// message headers stay on the top level part only
+			assert.Equal("alice@example.com", parts[0].e.Header.Get(headerFrom))
+			for _, i := range parts[1:] {
+				assert.False(i.e.Header.Has(headerFrom))
+			}
+
+			htmlPart := parts[tc.HTMLPart]
+			assert.Equal(encodingQuotedPrintable, htmlPart.Encoding)
+			_, params, err := htmlPart.e.Header.ContentType()
+			assert.NoError(err)
+			assert.Equal(charsetUTF8, params[paramCharset])
+			assert.Equal(doc, htmlPart.Body)
+		})
+	}
+}
+
+func Test_RelateHTML(t *testing.T) {
+	t.Parallel()
+
+	assert := require.New(t)
+
+	f := New().(*formatter)
+	assert.NoError(f.ReadMsg(strings.NewReader("From: alice@example.com\nSubject: lunch\n\nhi\n")))
+	assert.NoError(f.SetHTML(strings.NewReader(`<table background="dot.png"><tr><td><img src="dot.png"><img src="other.png"></td></tr></table>`)))
+	assert.NoError(f.AddInline(Attachment{
+		Name:    "dot.png",
+		Content: []byte("\x89PNG"),
+	}, "mail.example.com"))
+	parts := composeMsg(t, f)
+
+	var types []string
+	var paths [][]int
+	for _, i := range parts {
+		types = append(types, i.ContentType)
+		paths = append(paths, i.Path)
+	}
+	assert.Equal([]string{contentTypeMultipartAlternative, contentTypeTextPlain, contentTypeMultipartRelated, contentTypeTextHTML, "image/png"}, types)
+	assert.Equal([][]int{nil, {0}, {1}, {1, 0}, {1, 1}}, paths)
+
+	_, params, err := parts[2].e.Header.ContentType()
+	assert.NoError(err)
+	assert.Equal(contentTypeTextHTML, params[paramType])
+
+	img := parts[4]
+	assert.Equal("\x89PNG", img.Body)
+	disp, _, err := img.e.Header.ContentDisposition()
+	assert.NoError(err)
+	assert.Equal(dispositionInline, disp)
+	cid := img.e.Header.Get(headerContentID)
+	assert.True(strings.HasPrefix(cid, "<") && strings.HasSuffix(cid, "@mail.example.com>"))
+	cid = "cid:" + strings.TrimSuffix(strings.TrimPrefix(cid, "<"), ">")
+
+	assert.Equal(encodingQuotedPrintable, parts[3].Encoding)
+	// references to files that are not inline parts are kept
+	assert.Equal(`<table background="`+cid+`"><tr><td><img src="`+cid+`"><img src="other.png"></td></tr></table>`, parts[3].Body)
+}
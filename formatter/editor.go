@@ -0,0 +1,161 @@
+package formatter
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/emersion/go-message"
+)
+
+const (
+	envVisual = "VISUAL"
+	envEditor = "EDITOR"
+	ttyPath   = "/dev/tty"
+)
+
+// findEditor returns the command of the editor from $VISUAL or $EDITOR
+func findEditor() ([]string, error) {
+	for _, i := range []string{envVisual, envEditor} {
+		if args := strings.Fields(os.Getenv(i)); len(args) > 0 {
+			return args, nil
+		}
+	}
+	return nil, ErrNoEditor
+}
+
+// newDraft formats the message read from r in the editor convenient format,
+// with empty From and To headers for the user to fill in if they are missing.
+// Only the headers and body are in the draft. Parts other than the body, such
+// as an attached forward, are returned separately to be added after editing.
+func newDraft(r io.Reader, opts Opts) ([]byte, [][]byte, error) {
+	f := newFormatter(opts)
+	if err := readInput(f, r, opts); err != nil {
+		return nil, nil, err
+	}
+	parts := make([][]byte, 0, len(f.attachments))
+	for _, i := range f.attachments {
+		var b bytes.Buffer
+		if err := i.WriteTo(&b); err != nil {
+			return nil, nil, fmt.Errorf("Failed writing mail message part: %w", err)
+		}
+		parts = append(parts, b.Bytes())
+	}
+	f.attachments = nil
+	var draft bytes.Buffer
+	for _, i := range []string{headerFrom, headerTo} {
+		if !f.m.Header.Has(i) {
+			fmt.Fprintf(&draft, "%s: \n", i)
+		}
+	}
+	if err := f.WriteMsg(&draft, false); err != nil {
+		return nil, nil, err
+	}
+	return draft.Bytes(), parts, nil
+}
+
+// finalize formats the edited draft with the parts of the original message
+// and the parts of opts, validating its headers
+func finalize(draft []byte, parts [][]byte, opts Opts) ([]byte, error) {
+	f := newFormatter(opts)
+	if err := f.ReadMsg(bytes.NewReader(draft)); err != nil {
+		return nil, err
+	}
+	if err := f.SetHeaders(nil, nil); err != nil {
+		return nil, err
+	}
+	for _, i := range parts {
+		e, err := message.Read(bytes.NewReader(i))
+		if err != nil {
+			return nil, fmt.Errorf("Failed reading mail message part: %w", err)
+		}
+		f.attachments = append(f.attachments, e)
+	}
+	if err := addParts(f, opts); err != nil {
+		return nil, err
+	}
+	if err := f.SetHeadersFinal(opts.MsgIDDomain); err != nil {
+		return nil, err
+	}
+	var b bytes.Buffer
+	if err := f.WriteMsg(&b, opts.CRLF); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// Compose writes a draft of the message read from r to a temporary file and
+// opens it in $VISUAL or $EDITOR. The edited draft is validated, and the
+// editor is reopened on error until the draft is valid or the user gives up.
+// Attachments are added after editing, and the final formatted message is
+// written to w.
+func Compose(r io.Reader, w io.Writer, opts Opts) (retErr error) {
+	editor, err := findEditor()
+	if err != nil {
+		return err
+	}
+	draft, parts, err := newDraft(r, opts)
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp("", "mailcat-draft-*.eml")
+	if err != nil {
+		return fmt.Errorf("Failed to create draft file: %w", err)
+	}
+	defer func() {
+		if err := os.Remove(f.Name()); err != nil {
+			retErr = errors.Join(retErr, fmt.Errorf("Failed removing draft file %s: %w", f.Name(), err))
+		}
+	}()
+	if _, err := f.Write(draft); err != nil {
+		return errors.Join(fmt.Errorf("Failed writing draft file %s: %w", f.Name(), err), f.Close())
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("Failed closing draft file %s: %w", f.Name(), err)
+	}
+	// the editor is attached to the terminal since stdin and stdout may be
+	// redirected
+	tty, err := os.OpenFile(ttyPath, os.O_RDWR, 0)
+	if err != nil {
+		return fmt.Errorf("Failed to open terminal: %w", err)
+	}
+	defer func() {
+		if err := tty.Close(); err != nil {
+			retErr = errors.Join(retErr, fmt.Errorf("Failed closing terminal: %w", err))
+		}
+	}()
+	ttyReader := bufio.NewReader(tty)
+	for {
+		cmd := exec.Command(editor[0], append(editor[1:], f.Name())...)
+		cmd.Stdin = tty
+		cmd.Stdout = tty
+		cmd.Stderr = tty
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("Failed running editor %s: %w", editor[0], err)
+		}
+		edited, err := os.ReadFile(f.Name())
+		if err != nil {
+			return fmt.Errorf("Failed reading draft file %s: %w", f.Name(), err)
+		}
+		msg, err := finalize(edited, parts, opts)
+		if err == nil {
+			if _, err := w.Write(msg); err != nil {
+				return fmt.Errorf("Failed writing mail message: %w", err)
+			}
+			return nil
+		}
+		fmt.Fprintf(tty, "%v\nEdit again? [Y/n] ", err)
+		answer, rerr := ttyReader.ReadString('\n')
+		if rerr != nil && !errors.Is(rerr, io.EOF) {
+			return errors.Join(err, fmt.Errorf("Failed reading terminal: %w", rerr))
+		}
+		if a := strings.ToLower(strings.TrimSpace(answer)); a == "n" || a == "no" || errors.Is(rerr, io.EOF) {
+			return err
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package formatter
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/emersion/go-message"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Draft(t *testing.T) {
+	t.Parallel()
+
+	assert := require.New(t)
+
+	attachment := filepath.Join(t.TempDir(), "data.bin")
+	assert.NoError(os.WriteFile(attachment, []byte{0, 1, 2, 3}, 0o666))
+
+	opts := Opts{
+		Forward:       ForwardAttach,
+		Attachments:   []string{attachment},
+		MsgIDDomain:   "mail.example.com",
+		Deterministic: true,
+	}
+	orig := "From: alice@example.com\nSubject: lunch\nMessage-ID: <m1@example.com>\n\nhello\n"
+	draft, parts, err := newDraft(strings.NewReader(orig), opts)
+	assert.NoError(err)
+	assert.Len(parts, 1)
+	assert.Equal("From: \nTo: \nMime-Version: 1.0\nSubject: Fwd: lunch\nContent-Type: text/plain; charset=utf-8\n\n", string(draft))
+
+	edited := strings.Replace(strings.Replace(string(draft), "From: ", "From: bob@example.com", 1), "To: ", "To: carol@example.com", 1) + "see below\n"
+	msg, err := finalize([]byte(edited), parts, opts)
+	assert.NoError(err)
+
+	again, err := finalize([]byte(edited), parts, opts)
+	assert.NoError(err)
+	assert.Equal(string(msg), string(again))
+
+	f := New().(*formatter)
+	assert.NoError(f.ReadMsg(strings.NewReader(string(msg))))
+	var types []string
+	assert.NoError(f.m.Walk(func(path []int, e *message.Entity, err error) error {
+		if err != nil {
+			return err
+		}
+		t, _, err := e.Header.ContentType()
+		if err != nil {
+			return err
+		}
+		types = append(types, t)
+		return nil
+	}))
+	assert.Equal([]string{contentTypeMultipartMixed, contentTypeTextPlain, contentTypeMessageRFC822, "application/octet-stream"}, types)
+	assert.Contains(string(msg), "\nsee below\n")
+	assert.Contains(string(msg), orig[:strings.Index(orig, "\n")])
+}
@@ -0,0 +1,253 @@
+package formatter
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/emersion/go-message"
+)
+
+type (
+	// bodyClass is the most restrictive transfer encoding a body may be sent
+	// with unencoded
+	bodyClass int
+)
+
+const (
+	bodyClass7bit bodyClass = iota
+	bodyClass8bit
+	bodyClassBinary
+)
+
+const (
+	// EncodingAuto encodes parts with 7bit if possible, and otherwise with
+	// quoted-printable for text and base64 for everything else
+	EncodingAuto            = "auto"
+	Encoding7bit            = "7bit"
+	Encoding8bit            = "8bit"
+	EncodingQuotedPrintable = encodingQuotedPrintable
+	EncodingBase64          = encodingBase64
+
+	encodingQP     = "qp"
+	encodingBinary = "binary"
+)
+
+const (
+	// maxLineLen is the maximum line length of RFC 5322 excluding CRLF
+	maxLineLen = 998
+)
+
+const (
+	contentTypeText      = "text/"
+	contentTypeMultipart = "multipart/"
+	charsetUSASCII       = "us-ascii"
+)
+
+// ParseEncoding parses a transfer encoding option
+func ParseEncoding(enc string) (string, error) {
+	switch e := strings.ToLower(strings.TrimSpace(enc)); e {
+	case "":
+		return "", nil
+	case EncodingAuto, Encoding7bit, Encoding8bit, EncodingQuotedPrintable, EncodingBase64:
+		return e, nil
+	case encodingQP:
+		return EncodingQuotedPrintable, nil
+	default:
+		return "", fmt.Errorf("%w: unknown transfer encoding %s", ErrInvalidArgs, enc)
+	}
+}
+
+func (f *formatter) SetEncoding(enc string) error {
+	e, err := ParseEncoding(enc)
+	if err != nil {
+		return err
+	}
+	f.encoding = e
+	return nil
+}
+
+// classifyBody returns the class of a body by its 8-bit data, line lengths,
+// and bare carriage returns
+func classifyBody(b []byte) bodyClass {
+	c := bodyClass7bit
+	lineLen := 0
+	for n, i := range b {
+		switch {
+		case i == 0:
+			return bodyClassBinary
+		case i == '\r':
+			if n+1 >= len(b) || b[n+1] != '\n' {
+				return bodyClassBinary
+			}
+			continue
+		case i == '\n':
+			// bare line feeds are normalized to CRLF when written
+			lineLen = 0
+			continue
+		case i >= 0x80:
+			c = bodyClass8bit
+		}
+		lineLen++
+		if lineLen > maxLineLen {
+			return bodyClassBinary
+		}
+	}
+	return c
+}
+
+// encode sets the transfer encoding of every part of the message
+func (f *formatter) encode() error {
+	if f.encoding == "" {
+		return nil
+	}
+	m, err := encodeEntity(f.m, f.encoding, true)
+	if err != nil {
+		return err
+	}
+	f.m = m
+	return nil
+}
+
+// encodeEntity returns the entity with the transfer encoding of its parts
+// set to enc, reading multipart bodies into parts of their own so that their
+// parts may be encoded. Decoded is whether the body has been decoded from its
+// charset.
+func encodeEntity(e *message.Entity, enc string, decoded bool) (*message.Entity, error) {
+	t, params, _ := e.Header.ContentType()
+	if t == "" {
+		t = contentTypeTextPlain
+	}
+	if strings.HasPrefix(t, contentTypeMultipart) {
+		mr := e.MultipartReader()
+		var parts []*message.Entity
+		for {
+			p, err := mr.NextPart()
+			decoded := true
+			if err != nil {
+				if errors.Is(err, io.EOF) {
+					break
+				}
+				if !message.IsUnknownCharset(err) {
+					return nil, fmt.Errorf("Failed reading multipart mail message: %w", err)
+				}
+				// the body is left in its unknown charset
+				decoded = false
+			}
+			p, err = encodeEntity(p, enc, decoded)
+			if err != nil {
+				return nil, err
+			}
+			parts = append(parts, p)
+		}
+		h := e.Header.Copy()
+		h.Del(headerContentTransferEncoding)
+		m, err := message.NewMultipart(h, parts)
+		if err != nil {
+			return nil, fmt.Errorf("Failed creating multipart mail message: %w", err)
+		}
+		return m, nil
+	}
+	charset := ""
+	if decoded && strings.HasPrefix(t, contentTypeText) && params[paramCharset] != "" {
+		// bodies are decoded from their charset when read
+		charset = charsetUTF8
+	}
+	return encodePart(e, enc, charset)
+}
+
+// encodePart returns the single part entity with its transfer encoding set
+// to enc and its charset set to charset if not empty
+func encodePart(e *message.Entity, enc, charset string) (*message.Entity, error) {
+	t, params, _ := e.Header.ContentType()
+	if t == "" {
+		t = contentTypeTextPlain
+	}
+	b, err := io.ReadAll(e.Body)
+	if err != nil {
+		return nil, fmt.Errorf("Failed reading mail message body: %w", err)
+	}
+	h := e.Header.Copy()
+	if charset != "" && !strings.EqualFold(params[paramCharset], charset) {
+		switch strings.ToLower(params[paramCharset]) {
+		case charsetUTF8, charsetUSASCII:
+		default:
+			params[paramCharset] = charset
+			h.SetContentType(t, params)
+		}
+	}
+	class := classifyBody(b)
+	if t == contentTypeMessageRFC822 {
+		// attached messages may not be encoded, and are left unchanged so
+		// that any signatures of them remain valid unless 7bit is required
+		switch {
+		case class == bodyClass7bit:
+			h.Set(headerContentTransferEncoding, Encoding7bit)
+		case enc == Encoding8bit:
+			if class == bodyClass8bit {
+				h.Set(headerContentTransferEncoding, Encoding8bit)
+			} else {
+				h.Set(headerContentTransferEncoding, encodingBinary)
+			}
+		default:
+			// the parts of the attached message are encoded instead
+			inner, err := encodeMessage(b, enc)
+			if err != nil {
+				return nil, err
+			}
+			b = inner
+			h.Set(headerContentTransferEncoding, Encoding7bit)
+		}
+		return newEntity(h, bytes.NewReader(b))
+	}
+	switch enc {
+	case Encoding7bit:
+		if class != bodyClass7bit {
+			return nil, fmt.Errorf("%w: %s part is not 7bit", ErrInvalidBody, t)
+		}
+	case Encoding8bit:
+		if class == bodyClassBinary {
+			return nil, fmt.Errorf("%w: %s part is not 8bit", ErrInvalidBody, t)
+		}
+	case EncodingAuto:
+		switch {
+		case class == bodyClass7bit:
+			enc = Encoding7bit
+		case strings.HasPrefix(t, contentTypeText):
+			enc = EncodingQuotedPrintable
+		default:
+			enc = EncodingBase64
+		}
+	}
+	h.Set(headerContentTransferEncoding, enc)
+	return newEntity(h, bytes.NewReader(b))
+}
+
+// encodeMessage returns the attached message with the transfer encoding of
+// its parts set to enc, which must result in a 7bit message
+func encodeMessage(b []byte, enc string) ([]byte, error) {
+	e, err := message.Read(bytes.NewReader(b))
+	decoded := true
+	if err != nil {
+		if !message.IsUnknownCharset(err) {
+			return nil, fmt.Errorf("Failed reading attached mail message: %w", err)
+		}
+		// the body is left in its unknown charset
+		decoded = false
+	}
+	e, err = encodeEntity(e, enc, decoded)
+	if err != nil {
+		return nil, err
+	}
+	var out bytes.Buffer
+	if err := e.WriteTo(&out); err != nil {
+		return nil, fmt.Errorf("Failed writing attached mail message: %w", err)
+	}
+	if classifyBody(out.Bytes()) != bodyClass7bit {
+		// headers are not encoded
+		return nil, fmt.Errorf("%w: attached message is not 7bit", ErrInvalidBody)
+	}
+	return out.Bytes(), nil
+}
@@ -0,0 +1,330 @@
+package formatter
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/emersion/go-message"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_ClassifyBody(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		Name string
+		Inp  string
+		Exp  bodyClass
+	}{
+		{
+			Name: "Ascii with CRLF and bare LF",
+			Inp:  "hello\r\nworld\nbye",
+			Exp:  bodyClass7bit,
+		},
+		{
+			Name: "Line of the max length",
+			Inp:  strings.Repeat("a", maxLineLen) + "\r\n" + strings.Repeat("a", maxLineLen),
+			Exp:  bodyClass7bit,
+		},
+		{
+			Name: "8-bit data",
+			Inp:  "caf\xc3\xa9\r\n",
+			Exp:  bodyClass8bit,
+		},
+		{
+			Name: "Long line",
+			Inp:  strings.Repeat("a", maxLineLen+1) + "\r\n",
+			Exp:  bodyClassBinary,
+		},
+		{
+			Name: "Bare CR",
+			Inp:  "hello\rworld\r\n",
+			Exp:  bodyClassBinary,
+		},
+		{
+			Name: "Trailing CR",
+			Inp:  "hello\r",
+			Exp:  bodyClassBinary,
+		},
+		{
+			Name: "NUL",
+			Inp:  "hello\x00\r\n",
+			Exp:  bodyClassBinary,
+		},
+	} {
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			assert := require.New(t)
+
+			assert.Equal(tc.Exp, classifyBody([]byte(tc.Inp)))
+		})
+	}
+}
+
+func Test_EncodeEntity(t *testing.T) {
+	t.Parallel()
+
+	longLine := strings.Repeat("a", maxLineLen+1) + "\r\n"
+
+	for _, tc := range []struct {
+		Name   string
+		Type   string
+		Body   string
+		Enc    string
+		ExpEnc string
+		// ExpBody is the decoded body if it differs from Body
+		ExpBody string
+		Err     error
+	}{
+		{
+			Name:   "7bit ascii",
+			Type:   "text/plain",
+			Body:   "hello\r\n",
+			Enc:    Encoding7bit,
+			ExpEnc: Encoding7bit,
+		},
+		{
+			Name: "7bit rejects 8-bit data",
+			Type: "text/plain; charset=utf-8",
+			Body: "caf\xc3\xa9\r\n",
+			Enc:  Encoding7bit,
+			Err:  ErrInvalidBody,
+		},
+		{
+			Name: "7bit rejects long lines",
+			Type: "text/plain",
+			Body: longLine,
+			Enc:  Encoding7bit,
+			Err:  ErrInvalidBody,
+		},
+		{
+			Name: "7bit rejects bare CR",
+			Type: "text/plain",
+			Body: "hello\rworld\r\n",
+			Enc:  Encoding7bit,
+			Err:  ErrInvalidBody,
+		},
+		{
+			Name:   "8bit 8-bit data",
+			Type:   "text/plain; charset=utf-8",
+			Body:   "caf\xc3\xa9\r\n",
+			Enc:    Encoding8bit,
+			ExpEnc: Encoding8bit,
+		},
+		{
+			Name: "8bit rejects NUL",
+			Type: "application/octet-stream",
+			Body: "a\x00b",
+			Enc:  Encoding8bit,
+			Err:  ErrInvalidBody,
+		},
+		{
+			Name: "8bit rejects long lines",
+			Type: "text/plain",
+			Body: longLine,
+			Enc:  Encoding8bit,
+			Err:  ErrInvalidBody,
+		},
+		{
+			Name:   "Quoted-printable",
+			Type:   "text/plain; charset=utf-8",
+			Body:   "caf\xc3\xa9\r\n",
+			Enc:    EncodingQuotedPrintable,
+			ExpEnc: EncodingQuotedPrintable,
+		},
+		{
+			Name:   "Base64",
+			Type:   "text/plain",
+			Body:   "hello\r\n",
+			Enc:    EncodingBase64,
+			ExpEnc: EncodingBase64,
+		},
+		{
+			Name:   "Auto ascii",
+			Type:   "text/plain",
+			Body:   "hello\r\n",
+			Enc:    EncodingAuto,
+			ExpEnc: Encoding7bit,
+		},
+		{
+			Name:   "Auto 8-bit text",
+			Type:   "text/plain; charset=utf-8",
+			Body:   "caf\xc3\xa9\r\n",
+			Enc:    EncodingAuto,
+			ExpEnc: EncodingQuotedPrintable,
+		},
+		{
+			Name:   "Auto text with long lines",
+			Type:   "text/html",
+			Body:   longLine,
+			Enc:    EncodingAuto,
+			ExpEnc: EncodingQuotedPrintable,
+		},
+		{
+			Name:    "Auto text with bare CR has its line breaks normalized",
+			Type:    "text/plain",
+			Body:    "hello\rworld\r\n",
+			Enc:     EncodingAuto,
+			ExpEnc:  EncodingQuotedPrintable,
+			ExpBody: "hello\r\nworld\r\n",
+		},
+		{
+			Name:   "Auto binary with NUL",
+			Type:   "application/octet-stream",
+			Body:   "a\x00b",
+			Enc:    EncodingAuto,
+			ExpEnc: EncodingBase64,
+		},
+		{
+			Name:   "Auto ascii binary",
+			Type:   "application/octet-stream",
+			Body:   "hello\r\n",
+			Enc:    EncodingAuto,
+			ExpEnc: Encoding7bit,
+		},
+	} {
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			assert := require.New(t)
+
+			var h message.Header
+			h.Set(headerContentType, tc.Type)
+			e, err := message.New(h, strings.NewReader(tc.Body))
+			assert.NoError(err)
+			e, err = encodeEntity(e, tc.Enc, true)
+			if tc.Err != nil {
+				assert.ErrorIs(err, tc.Err)
+				return
+			}
+			assert.NoError(err)
+
+			var b bytes.Buffer
+			assert.NoError(e.WriteTo(&b))
+			m, err := message.Read(bytes.NewReader(b.Bytes()))
+			assert.NoError(err)
+			assert.Equal(tc.ExpEnc, m.Header.Get(headerContentTransferEncoding))
+			body, err := io.ReadAll(m.Body)
+			assert.NoError(err)
+			exp := tc.Body
+			if tc.ExpBody != "" {
+				exp = tc.ExpBody
+			}
+			assert.Equal(exp, string(body))
+		})
+	}
+}
+
+func Test_EncodeEntityRFC822(t *testing.T) {
+	t.Parallel()
+
+	const (
+		ascii      = "Subject: lunch\r\nContent-Type: text/plain\r\n\r\nhello\r\n"
+		body8bit   = "Subject: lunch\r\nContent-Type: multipart/mixed; boundary=XX\r\n\r\n--XX\r\nContent-Type: text/plain; charset=utf-8\r\nContent-Transfer-Encoding: 8bit\r\n\r\ncaf\xc3\xa9\r\n--XX\r\nContent-Type: application/octet-stream\r\nContent-Transfer-Encoding: binary\r\n\r\na\x00b\r\n--XX--\r\n"
+		header8bit = "Subject: caf\xc3\xa9\r\nContent-Type: text/plain\r\n\r\nhello\r\n"
+	)
+
+	for _, tc := range []struct {
+		Name     string
+		Inner    string
+		Enc      string
+		ExpEnc   string
+		ExpInner string
+		ExpParts []string
+		Err      error
+	}{
+		{
+			Name:     "7bit message is unchanged",
+			Inner:    ascii,
+			Enc:      EncodingAuto,
+			ExpEnc:   Encoding7bit,
+			ExpInner: ascii,
+		},
+		{
+			Name:     "8bit keeps 8-bit message unchanged",
+			Inner:    header8bit,
+			Enc:      Encoding8bit,
+			ExpEnc:   Encoding8bit,
+			ExpInner: header8bit,
+		},
+		{
+			Name:     "Auto encodes the parts of an 8-bit message",
+			Inner:    body8bit,
+			Enc:      EncodingAuto,
+			ExpEnc:   Encoding7bit,
+			ExpParts: []string{EncodingQuotedPrintable, EncodingBase64},
+		},
+		{
+			Name:     "Base64 encodes the parts of an 8-bit message",
+			Inner:    body8bit,
+			Enc:      EncodingBase64,
+			ExpEnc:   Encoding7bit,
+			ExpParts: []string{EncodingBase64, EncodingBase64},
+		},
+		{
+			Name:  "7bit rejects an 8-bit message",
+			Inner: body8bit,
+			Enc:   Encoding7bit,
+			Err:   ErrInvalidBody,
+		},
+		{
+			Name:  "Auto rejects 8-bit message headers",
+			Inner: header8bit,
+			Enc:   EncodingAuto,
+			Err:   ErrInvalidBody,
+		},
+	} {
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			assert := require.New(t)
+
+			var h message.Header
+			h.Set(headerContentType, contentTypeMessageRFC822)
+			part, err := message.New(h, strings.NewReader(tc.Inner))
+			assert.NoError(err)
+			var mh message.Header
+			mh.Set(headerContentType, "multipart/mixed; boundary=YY")
+			e, err := message.NewMultipart(mh, []*message.Entity{part})
+			assert.NoError(err)
+			e, err = encodeEntity(e, tc.Enc, true)
+			if tc.Err != nil {
+				assert.ErrorIs(err, tc.Err)
+				return
+			}
+			assert.NoError(err)
+
+			var b bytes.Buffer
+			assert.NoError(e.WriteTo(&b))
+			if tc.Enc != Encoding8bit {
+				assert.Equal(bodyClass7bit, classifyBody(b.Bytes()))
+			}
+			m, err := message.Read(bytes.NewReader(b.Bytes()))
+			assert.NoError(err)
+			p, err := m.MultipartReader().NextPart()
+			assert.NoError(err)
+			assert.Equal(tc.ExpEnc, p.Header.Get(headerContentTransferEncoding))
+			inner, err := io.ReadAll(p.Body)
+			assert.NoError(err)
+			if tc.ExpInner != "" {
+				assert.Equal(tc.ExpInner, string(inner))
+			}
+			if tc.ExpParts != nil {
+				im, err := message.Read(bytes.NewReader(inner))
+				assert.NoError(err)
+				var encs []string
+				mr := im.MultipartReader()
+				for {
+					ip, err := mr.NextPart()
+					if errors.Is(err, io.EOF) {
+						break
+					}
+					assert.NoError(err)
+					encs = append(encs, ip.Header.Get(headerContentTransferEncoding))
+				}
+				assert.Equal(tc.ExpParts, encs)
+			}
+		})
+	}
+}
@@ -1,10 +1,14 @@
 package formatter
 
 import (
+	"crypto/rand"
 	"errors"
 	"fmt"
 	"io"
+	mrand "math/rand"
 	"net/textproto"
+	"os"
+	"strconv"
 	"strings"
 	"time"
 
@@ -18,68 +22,277 @@ import (
 
 type (
 	Opts struct {
-		CRLF        bool
-		Body        bool
-		Headers     []string
-		AddHeaders  []string
-		MsgIDDomain string
-		Edit        bool
+		CRLF         bool
+		Body         bool
+		JSON         bool
+		Headers      []string
+		AddHeaders   []string
+		Remove       []string
+		Replace      []string
+		MsgIDDomain  string
+		ListID       string
+		UnsubMailto  string
+		UnsubURL     string
+		Edit         bool
+		Reply        bool
+		ReplyAll     bool
+		Forward      string
+		Template     bool
+		TemplateData string
+		Vars         []string
+		HTML         string
+		Markdown     bool
+		CSS          string
+		Inline       []string
+		Attachments  []string
+		// Encoding is the transfer encoding of every part, one of 7bit, 8bit,
+		// quoted-printable, base64, or auto, and parts are unchanged if empty
+		Encoding string
+		// Deterministic makes the generated Date, Message-ID, Content-IDs,
+		// and boundaries reproducible from Seed and Now
+		Deterministic bool
+		Seed          int64
+		// Now is the Date of messages without one if Deterministic, and
+		// defaults to the unix epoch
+		Now time.Time
 	}
 
 	Formatter interface {
+		RewriteHeaders(remove, replace []string) error
 		SetHeaders(setHeaders, addHeaders []string) error
 		SetHeadersFinal(msgidDomain string) error
+		SetList(listID, mailto, httpsURL string) error
 		ReadBody(r io.Reader) error
 		ReadMsg(r io.Reader) error
+		ReadJSON(r io.Reader, msgidDomain string) error
+		Reply(all bool, self []*emmail.Address) error
+		Forward() error
+		ForwardAttach(r io.Reader) error
+		SetHTML(r io.Reader) error
+		RenderMarkdown(css string) error
+		AddInline(a Attachment, msgidDomain string) error
+		AddAttachment(a Attachment) error
+		SetEncoding(enc string) error
 		WriteMsg(w io.Writer, crlf bool) error
 	}
 
 	formatter struct {
-		m *message.Entity
+		now         func() time.Time
+		rand        io.Reader
+		m           *message.Entity
+		html        *message.Entity
+		inline      []inlinePart
+		attachments []*message.Entity
+		encoding    string
 	}
 )
 
 func Format(r io.Reader, w io.Writer, opts Opts) error {
-	f := New()
-	if opts.Body {
+	f := newFormatter(opts)
+	if err := readInput(f, r, opts); err != nil {
+		return err
+	}
+	if err := addParts(f, opts); err != nil {
+		return err
+	}
+	if opts.Edit {
+		if err := f.WriteMsg(w, false); err != nil {
+			return err
+		}
+		return nil
+	}
+	if err := f.SetHeadersFinal(opts.MsgIDDomain); err != nil {
+		return err
+	}
+	if err := f.WriteMsg(w, opts.CRLF); err != nil {
+		return err
+	}
+	return nil
+}
+
+// readInput reads the message from r, executing it as a template if
+// required, and makes it a reply or forward and sets its headers according to
+// opts
+func readInput(f Formatter, r io.Reader, opts Opts) error {
+	if opts.Template {
+		t, err := ParseTemplate(r)
+		if err != nil {
+			return err
+		}
+		data, err := ReadTemplateData(opts.TemplateData, opts.Vars)
+		if err != nil {
+			return err
+		}
+		r, err = ExecTemplate(t, data)
+		if err != nil {
+			return err
+		}
+	}
+	reply := opts.Reply || opts.ReplyAll
+	if reply && opts.Forward != "" {
+		return fmt.Errorf("%w: may not both reply and forward", ErrInvalidArgs)
+	}
+	if (reply || opts.Forward != "") && (opts.Body || opts.JSON) {
+		return fmt.Errorf("%w: reply and forward require a full message", ErrInvalidArgs)
+	}
+	if opts.Body && opts.JSON {
+		return fmt.Errorf("%w: input may not be both a body and json", ErrInvalidArgs)
+	}
+	switch {
+	case opts.Forward == ForwardAttach:
+		if err := f.ForwardAttach(r); err != nil {
+			return err
+		}
+	case opts.Body:
 		if err := f.ReadBody(r); err != nil {
 			return err
 		}
-	} else {
+	case opts.JSON:
+		if err := f.ReadJSON(r, opts.MsgIDDomain); err != nil {
+			return err
+		}
+	default:
 		if err := f.ReadMsg(r); err != nil {
 			return err
 		}
 	}
+	if reply {
+		self, err := headerAddrs(headerFrom, opts.Headers, opts.AddHeaders)
+		if err != nil {
+			return err
+		}
+		if err := f.Reply(opts.ReplyAll, self); err != nil {
+			return err
+		}
+	}
+	switch opts.Forward {
+	case "", ForwardAttach:
+	case ForwardInline:
+		if err := f.Forward(); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("%w: unknown forward mode %s", ErrInvalidArgs, opts.Forward)
+	}
+	if err := f.RewriteHeaders(opts.Remove, opts.Replace); err != nil {
+		return err
+	}
 	if err := f.SetHeaders(opts.Headers, opts.AddHeaders); err != nil {
 		return err
 	}
-	if opts.Edit {
-		if err := f.WriteMsg(w, false); err != nil {
+	if err := f.SetList(opts.ListID, opts.UnsubMailto, opts.UnsubURL); err != nil {
+		return err
+	}
+	return nil
+}
+
+// addParts adds the html, inline, and attachment parts of opts to the message
+// and sets its transfer encoding
+func addParts(f Formatter, opts Opts) error {
+	if opts.Markdown {
+		if opts.HTML != "" {
+			return fmt.Errorf("%w: markdown body may not have an html file", ErrInvalidBody)
+		}
+		css := DefaultCSS
+		if opts.CSS != "" {
+			b, err := os.ReadFile(opts.CSS)
+			if err != nil {
+				return fmt.Errorf("Failed reading file %s: %w", opts.CSS, err)
+			}
+			css = string(b)
+		}
+		if err := f.RenderMarkdown(css); err != nil {
+			return err
+		}
+	} else if opts.HTML != "" {
+		r, err := openFile(opts.HTML)
+		if err != nil {
+			return err
+		}
+		if err := f.SetHTML(r); err != nil {
 			return err
 		}
-		return nil
 	}
-	if err := f.SetHeadersFinal(opts.MsgIDDomain); err != nil {
-		return err
+	for _, i := range opts.Inline {
+		a, err := ParseAttachment(i)
+		if err != nil {
+			return err
+		}
+		if err := f.AddInline(a, opts.MsgIDDomain); err != nil {
+			return err
+		}
 	}
-	if err := f.WriteMsg(w, opts.CRLF); err != nil {
+	for _, i := range opts.Attachments {
+		a, err := ParseAttachment(i)
+		if err != nil {
+			return err
+		}
+		if err := f.AddAttachment(a); err != nil {
+			return err
+		}
+	}
+	if err := f.SetEncoding(opts.Encoding); err != nil {
 		return err
 	}
 	return nil
 }
 
 func New() Formatter {
-	return &formatter{}
+	return &formatter{
+		now:  time.Now,
+		rand: rand.Reader,
+	}
+}
+
+// NewDeterministic creates a formatter that generates the same Date,
+// Message-ID, Content-IDs, and boundaries for the same seed and time
+func NewDeterministic(seed int64, now time.Time) Formatter {
+	if now.IsZero() {
+		now = time.Unix(0, 0).UTC()
+	}
+	return &formatter{
+		now: func() time.Time {
+			return now
+		},
+		rand: mrand.New(mrand.NewSource(seed)),
+	}
+}
+
+func newFormatter(opts Opts) *formatter {
+	if opts.Deterministic {
+		return NewDeterministic(opts.Seed, opts.Now).(*formatter)
+	}
+	return New().(*formatter)
+}
+
+// SourceDateEpoch returns the time of the SOURCE_DATE_EPOCH environment
+// variable if set
+func SourceDateEpoch() (time.Time, bool, error) {
+	v, ok := os.LookupEnv(envSourceDateEpoch)
+	if !ok || v == "" {
+		return time.Time{}, false, nil
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("%w: invalid %s %s", ErrInvalidArgs, envSourceDateEpoch, v)
+	}
+	return time.Unix(n, 0).UTC(), true, nil
 }
 
 var (
 	ErrNoMsg         = errors.New("No mail message read")
 	ErrInvalidHeader = errors.New("Invalid header")
 	ErrNoEditor      = errors.New("No editor found")
+	ErrInvalidArgs   = errors.New("Invalid args")
+)
+
+const (
+	msgidRandBytes    = 16
+	boundaryRandBytes = 30
 )
 
 const (
-	msgidRandBytes = 16
+	envSourceDateEpoch = "SOURCE_DATE_EPOCH"
 )
 
 const (
@@ -101,13 +314,41 @@ const (
 )
 
 func (f *formatter) genMsgID(msgidDomain string) (string, error) {
-	u, err := uid.NewSnowflake(msgidRandBytes)
+	u, err := uid.NewSnowflakeFrom(f.now(), f.rand, msgidRandBytes)
 	if err != nil {
 		return "", fmt.Errorf("Failed to generate msgid: %w", err)
 	}
 	return fmt.Sprintf("%s@%s", u.Base32(), msgidDomain), nil
 }
 
+func (f *formatter) genBoundary() (string, error) {
+	var b [boundaryRandBytes]byte
+	if _, err := io.ReadFull(f.rand, b[:]); err != nil {
+		return "", fmt.Errorf("Failed to generate boundary: %w", err)
+	}
+	return fmt.Sprintf("%x", b[:]), nil
+}
+
+// headerAddrs parses the addresses of a header from HEADER:VALUE header
+// options
+func headerAddrs(key string, headers ...[]string) ([]*emmail.Address, error) {
+	var addrs []*emmail.Address
+	for _, i := range headers {
+		for _, j := range i {
+			k, v, ok := strings.Cut(j, ":")
+			if !ok || textproto.CanonicalMIMEHeaderKey(strings.TrimSpace(k)) != key {
+				continue
+			}
+			a, err := emmail.ParseAddressList(strings.TrimSpace(v))
+			if err != nil {
+				return nil, fmt.Errorf("Invalid %s: %w", key, err)
+			}
+			addrs = append(addrs, a...)
+		}
+	}
+	return addrs, nil
+}
+
 func (f *formatter) SetHeaders(setHeaders, addHeaders []string) error {
 	if f.m == nil {
 		return ErrNoMsg
@@ -136,6 +377,17 @@ func (f *formatter) SetHeaders(setHeaders, addHeaders []string) error {
 		v := strings.TrimSpace(parts[1])
 		headers.Add(k, v)
 	}
+	if err := CanonicalizeHeader(&headers); err != nil {
+		return err
+	}
+	f.m.Header = headers.Header
+	return nil
+}
+
+// CanonicalizeHeader rewrites the structured fields of a message header in
+// their canonical form
+func CanonicalizeHeader(headers *emmail.Header) error {
+	// headers are in reverse order of appearance since headers are prepended
 	if headers.Has(headerContentType) {
 		if t, params, err := headers.ContentType(); err != nil {
 			return fmt.Errorf("Invalid Content-Type: %w", err)
@@ -195,7 +447,6 @@ func (f *formatter) SetHeaders(setHeaders, addHeaders []string) error {
 		}
 		headers.SetDate(t)
 	}
-	f.m.Header = headers.Header
 	return nil
 }
 
@@ -289,7 +540,7 @@ func (f *formatter) SetHeadersFinal(msgidDomain string) error {
 		}
 		headers.SetDate(t)
 	} else {
-		headers.SetDate(time.Now().Round(0))
+		headers.SetDate(f.now().Round(0))
 	}
 	f.m.Header = headers.Header
 	return nil
@@ -319,6 +570,12 @@ func (f *formatter) WriteMsg(w io.Writer, crlf bool) error {
 	if f.m == nil {
 		return ErrNoMsg
 	}
+	if err := f.compose(); err != nil {
+		return err
+	}
+	if err := f.encode(); err != nil {
+		return err
+	}
 	if !crlf {
 		w = transform.NewWriter(w, transformer.LF{})
 	}
@@ -0,0 +1,109 @@
+package formatter
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-message"
+	emmail "github.com/emersion/go-message/mail"
+	"github.com/stretchr/testify/require"
+)
+
+const testDeterministicInp = `{
+  "from": "alice@example.com",
+  "to": "bob@example.com",
+  "subject": "lunch",
+  "text": "hello\n",
+  "html": "<p>hello <img src=\"dot.png\"></p>",
+  "attachments": [
+    {"name": "dot.png", "content": "iVBORw0KGgo=", "inline": true},
+    {"name": "notes.txt", "content": "aGVsbG8K"}
+  ]
+}`
+
+// formatDeterministic formats the test message and returns it with its
+// Message-ID, Date, and multipart boundaries
+func formatDeterministic(t *testing.T, opts Opts) (string, string, time.Time, []string) {
+	t.Helper()
+	assert := require.New(t)
+
+	opts.JSON = true
+	opts.MsgIDDomain = "mail.example.com"
+	opts.Deterministic = true
+	var b bytes.Buffer
+	assert.NoError(Format(strings.NewReader(testDeterministicInp), &b, opts))
+
+	m, err := message.Read(bytes.NewReader(b.Bytes()))
+	assert.NoError(err)
+	headers := emmail.Header{Header: m.Header}
+	msgid, err := headers.MessageID()
+	assert.NoError(err)
+	date, err := headers.Date()
+	assert.NoError(err)
+	var boundaries []string
+	assert.NoError(m.Walk(func(path []int, e *message.Entity, err error) error {
+		if err != nil {
+			return err
+		}
+		if _, params, err := e.Header.ContentType(); err == nil && params[paramBoundary] != "" {
+			boundaries = append(boundaries, params[paramBoundary])
+		}
+		return nil
+	}))
+	return b.String(), msgid, date, boundaries
+}
+
+func Test_FormatDeterministic(t *testing.T) {
+	t.Parallel()
+
+	assert := require.New(t)
+
+	now := time.Date(2001, time.February, 3, 4, 5, 6, 0, time.UTC)
+	msg, msgid, date, boundaries := formatDeterministic(t, Opts{Seed: 42, Now: now})
+	assert.NotEmpty(msgid)
+	assert.True(now.Equal(date))
+	assert.Len(boundaries, 3)
+
+	again, againMsgid, _, againBoundaries := formatDeterministic(t, Opts{Seed: 42, Now: now})
+	assert.Equal(msg, again)
+	assert.Equal(msgid, againMsgid)
+	assert.Equal(boundaries, againBoundaries)
+
+	other, otherMsgid, _, otherBoundaries := formatDeterministic(t, Opts{Seed: 43, Now: now})
+	assert.NotEqual(msg, other)
+	assert.NotEqual(msgid, otherMsgid)
+	assert.NotEqual(boundaries, otherBoundaries)
+
+	_, _, epoch, _ := formatDeterministic(t, Opts{Seed: 42})
+	assert.True(time.Unix(0, 0).Equal(epoch))
+}
+
+func Test_SourceDateEpoch(t *testing.T) {
+	// t.Setenv may not be used in parallel tests
+	assert := require.New(t)
+
+	t.Setenv(envSourceDateEpoch, "981173106")
+	now, ok, err := SourceDateEpoch()
+	assert.NoError(err)
+	assert.True(ok)
+	assert.Equal(time.Date(2001, time.February, 3, 4, 5, 6, 0, time.UTC), now)
+
+	msg, msgid, date, boundaries := formatDeterministic(t, Opts{Now: now})
+	assert.True(now.Equal(date))
+	again, againMsgid, againDate, againBoundaries := formatDeterministic(t, Opts{Now: now})
+	assert.Equal(msg, again)
+	assert.Equal(msgid, againMsgid)
+	assert.True(date.Equal(againDate))
+	assert.Equal(boundaries, againBoundaries)
+
+	t.Setenv(envSourceDateEpoch, "")
+	_, ok, err = SourceDateEpoch()
+	assert.NoError(err)
+	assert.False(ok)
+
+	t.Setenv(envSourceDateEpoch, "yesterday")
+	_, _, err = SourceDateEpoch()
+	assert.ErrorIs(err, ErrInvalidArgs)
+}
@@ -0,0 +1,253 @@
+package formatter
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+type (
+	cssRule struct {
+		selectors []cssSelector
+		decls     string
+	}
+
+	// cssSelector is a simple selector of a tag name and classes
+	cssSelector struct {
+		tag     string
+		classes []string
+	}
+)
+
+const (
+	attrStyle      = "style"
+	attrClass      = "class"
+	attrSrc        = "src"
+	attrBackground = "background"
+
+	tagBody = "body"
+)
+
+// stripCSSComments removes all /* */ comments from css
+func stripCSSComments(css string) string {
+	var b strings.Builder
+	for {
+		start := strings.Index(css, "/*")
+		if start < 0 {
+			b.WriteString(css)
+			return b.String()
+		}
+		b.WriteString(css[:start])
+		end := strings.Index(css[start+2:], "*/")
+		if end < 0 {
+			return b.String()
+		}
+		css = css[start+2+end+2:]
+	}
+}
+
+// skipBlock returns the remainder of css after the block beginning at the
+// first open brace, accounting for nested blocks
+func skipBlock(css string) string {
+	depth := 0
+	for n, i := range css {
+		switch i {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth <= 0 {
+				return css[n+1:]
+			}
+		}
+	}
+	return ""
+}
+
+func parseCSSSelector(s string) (cssSelector, bool) {
+	if s == "" || strings.ContainsAny(s, " \t\n>+~:[#()") {
+		return cssSelector{}, false
+	}
+	parts := strings.Split(s, ".")
+	sel := cssSelector{
+		tag: strings.ToLower(parts[0]),
+	}
+	if sel.tag == "*" {
+		sel.tag = ""
+	}
+	for _, i := range parts[1:] {
+		if i == "" {
+			return cssSelector{}, false
+		}
+		sel.classes = append(sel.classes, i)
+	}
+	return sel, true
+}
+
+// parseCSS parses the rules of a stylesheet that may be inlined. Only rules
+// with simple selectors of a tag name and classes are returned, since other
+// selectors cannot be evaluated without a document tree. At-rules are
+// skipped.
+func parseCSS(css string) []cssRule {
+	css = stripCSSComments(css)
+	var rules []cssRule
+	for {
+		css = strings.TrimSpace(css)
+		if css == "" {
+			return rules
+		}
+		if css[0] == '@' {
+			semi := strings.IndexByte(css, ';')
+			brace := strings.IndexByte(css, '{')
+			if semi >= 0 && (brace < 0 || semi < brace) {
+				css = css[semi+1:]
+			} else {
+				css = skipBlock(css)
+			}
+			continue
+		}
+		open := strings.IndexByte(css, '{')
+		if open < 0 {
+			return rules
+		}
+		end := strings.IndexByte(css[open:], '}')
+		if end < 0 {
+			return rules
+		}
+		selText := css[:open]
+		decls := strings.Join(strings.Fields(css[open+1:open+end]), " ")
+		css = css[open+end+1:]
+		var sels []cssSelector
+		for _, i := range strings.Split(selText, ",") {
+			if sel, ok := parseCSSSelector(strings.TrimSpace(i)); ok {
+				sels = append(sels, sel)
+			}
+		}
+		if len(sels) == 0 || decls == "" {
+			continue
+		}
+		rules = append(rules, cssRule{
+			selectors: sels,
+			decls:     decls,
+		})
+	}
+}
+
+func tokenAttr(t *html.Token, key string) (string, bool) {
+	for _, i := range t.Attr {
+		if i.Namespace == "" && strings.EqualFold(i.Key, key) {
+			return i.Val, true
+		}
+	}
+	return "", false
+}
+
+func setTokenAttr(t *html.Token, key, val string) {
+	for n, i := range t.Attr {
+		if i.Namespace == "" && strings.EqualFold(i.Key, key) {
+			t.Attr[n].Val = val
+			return
+		}
+	}
+	t.Attr = append(t.Attr, html.Attribute{
+		Key: key,
+		Val: val,
+	})
+}
+
+func (s cssSelector) matches(t *html.Token) bool {
+	if s.tag != "" && s.tag != t.Data {
+		return false
+	}
+	if len(s.classes) == 0 {
+		return true
+	}
+	class, _ := tokenAttr(t, attrClass)
+	classes := strings.Fields(class)
+	for _, i := range s.classes {
+		found := false
+		for _, j := range classes {
+			if i == j {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// inlineStyles sets the style attribute of an element from matching rules in
+// order of appearance, with any existing style attribute taking precedence
+func inlineStyles(t *html.Token, rules []cssRule) bool {
+	var decls []string
+	for _, i := range rules {
+		for _, j := range i.selectors {
+			if j.matches(t) {
+				decls = append(decls, strings.TrimSuffix(i.decls, ";"))
+				break
+			}
+		}
+	}
+	if len(decls) == 0 {
+		return false
+	}
+	if style, ok := tokenAttr(t, attrStyle); ok && strings.TrimSpace(style) != "" {
+		decls = append(decls, strings.TrimSuffix(strings.TrimSpace(style), ";"))
+	}
+	setTokenAttr(t, attrStyle, strings.Join(decls, "; "))
+	return true
+}
+
+// rewriteHTML calls fn on every start tag of the html document, and
+// reserializes the tags that fn reports as modified. All other content is
+// preserved byte for byte.
+func rewriteHTML(doc []byte, fn func(t *html.Token) bool) ([]byte, error) {
+	var b bytes.Buffer
+	z := html.NewTokenizer(bytes.NewReader(doc))
+	for {
+		tt := z.Next()
+		switch tt {
+		case html.ErrorToken:
+			if err := z.Err(); !errors.Is(err, io.EOF) {
+				return nil, fmt.Errorf("Failed parsing html: %w", err)
+			}
+			return b.Bytes(), nil
+		case html.StartTagToken, html.SelfClosingTagToken:
+			raw := bytes.Clone(z.Raw())
+			t := z.Token()
+			if fn(&t) {
+				b.WriteString(t.String())
+			} else {
+				b.Write(raw)
+			}
+		default:
+			b.Write(z.Raw())
+		}
+	}
+}
+
+// inlineCSS inlines the simple rules of a stylesheet into the style attributes
+// of the elements of the html document body
+func inlineCSS(doc []byte, css string) ([]byte, error) {
+	rules := parseCSS(css)
+	if len(rules) == 0 {
+		return doc, nil
+	}
+	inBody := false
+	return rewriteHTML(doc, func(t *html.Token) bool {
+		if t.Data == tagBody {
+			inBody = true
+		}
+		if !inBody {
+			return false
+		}
+		return inlineStyles(t, rules)
+	})
+}
@@ -0,0 +1,40 @@
+package formatter
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_InlineCSS(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		Name string
+		CSS  string
+		Inp  string
+		Exp  string
+	}{
+		{
+			Name: "Simple selectors in order with existing style last",
+			CSS:  "/* comment */ p { margin: 0; }\n.x, em { color:\n  blue }\np.x { padding: 1px }",
+			Inp:  `<html><head><p>head</p></head><body><p class="x y" style="color: red">a <em>b</em></p><br/></body></html>`,
+			Exp:  `<html><head><p>head</p></head><body><p class="x y" style="margin: 0; color: blue; padding: 1px; color: red">a <em style="color: blue">b</em></p><br/></body></html>`,
+		},
+		{
+			Name: "Complex selectors and at-rules are skipped",
+			CSS:  "@import url(a.css);\n@media (max-width: 600px) { p { color: blue } }\ndiv p, a:hover, #id { color: green }\n* { margin: 0 }",
+			Inp:  `<body><div><p>a</p></div></body>`,
+			Exp:  `<body style="margin: 0"><div style="margin: 0"><p style="margin: 0">a</p></div></body>`,
+		},
+	} {
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			assert := require.New(t)
+
+			b, err := inlineCSS([]byte(tc.Inp), tc.CSS)
+			assert.NoError(err)
+			assert.Equal(tc.Exp, string(b))
+		})
+	}
+}
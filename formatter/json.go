@@ -0,0 +1,146 @@
+package formatter
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/textproto"
+	"sort"
+	"strings"
+
+	"github.com/emersion/go-message"
+	emmail "github.com/emersion/go-message/mail"
+	"golang.org/x/text/transform"
+	"xorkevin.dev/mailcat/transformer"
+)
+
+type (
+	// JSONMessage is a message as a JSON object
+	JSONMessage struct {
+		From        string                `json:"from"`
+		To          stringList            `json:"to"`
+		Cc          stringList            `json:"cc"`
+		Bcc         stringList            `json:"bcc"`
+		ReplyTo     string                `json:"reply_to"`
+		Subject     string                `json:"subject"`
+		Headers     map[string]stringList `json:"headers"`
+		Text        string                `json:"text"`
+		HTML        string                `json:"html"`
+		Attachments []JSONAttachment      `json:"attachments"`
+	}
+
+	// JSONAttachment is an attachment of a [JSONMessage] from a file path or
+	// from base64 encoded content
+	JSONAttachment struct {
+		Path        string `json:"path"`
+		Name        string `json:"name"`
+		ContentType string `json:"content_type"`
+		Content     []byte `json:"content"`
+		Inline      bool   `json:"inline"`
+	}
+
+	// stringList is a list of strings that may also be a single string in
+	// JSON
+	stringList []string
+)
+
+func (s *stringList) UnmarshalJSON(b []byte) error {
+	var v string
+	if err := json.Unmarshal(b, &v); err == nil {
+		*s = stringList{v}
+		return nil
+	}
+	var l []string
+	if err := json.Unmarshal(b, &l); err != nil {
+		return err
+	}
+	*s = l
+	return nil
+}
+
+// ReadJSON reads a message from a [JSONMessage] object
+func (f *formatter) ReadJSON(r io.Reader, msgidDomain string) error {
+	var jm JSONMessage
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&jm); err != nil {
+		return fmt.Errorf("Failed reading json mail message: %w", err)
+	}
+
+	headers := emmail.Header{}
+	// headers are in reverse order of appearance since headers are prepended
+	keys := make([]string, 0, len(jm.Headers))
+	for k := range jm.Headers {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return textproto.CanonicalMIMEHeaderKey(keys[i]) > textproto.CanonicalMIMEHeaderKey(keys[j])
+	})
+	for _, k := range keys {
+		vals := jm.Headers[k]
+		for i := len(vals) - 1; i >= 0; i-- {
+			headers.Add(textproto.CanonicalMIMEHeaderKey(k), mime.QEncoding.Encode(charsetUTF8, vals[i]))
+		}
+	}
+	headers.SetContentType(contentTypeTextPlain, map[string]string{
+		paramCharset: charsetUTF8,
+	})
+	if jm.Subject != "" {
+		headers.SetSubject(jm.Subject)
+	}
+	for _, i := range []struct {
+		key   string
+		addrs []string
+	}{
+		{key: headerReplyTo, addrs: nonEmpty(jm.ReplyTo)},
+		{key: headerBcc, addrs: jm.Bcc},
+		{key: headerCc, addrs: jm.Cc},
+		{key: headerTo, addrs: jm.To},
+		{key: headerFrom, addrs: nonEmpty(jm.From)},
+	} {
+		if len(i.addrs) == 0 {
+			continue
+		}
+		addrs, err := emmail.ParseAddressList(strings.Join(i.addrs, ", "))
+		if err != nil {
+			return fmt.Errorf("Invalid %s: %w", i.key, err)
+		}
+		headers.SetAddressList(i.key, addrs)
+	}
+	m, err := message.New(headers.Header, transform.NewReader(strings.NewReader(jm.Text), transformer.CRLF{}))
+	if err != nil {
+		return fmt.Errorf("Failed creating mail message: %w", err)
+	}
+	f.m = m
+	if jm.HTML != "" {
+		if err := f.SetHTML(strings.NewReader(jm.HTML)); err != nil {
+			return err
+		}
+	}
+	for _, i := range jm.Attachments {
+		a := Attachment{
+			Path:        i.Path,
+			ContentType: i.ContentType,
+			Name:        i.Name,
+			Content:     i.Content,
+		}
+		if i.Inline {
+			if err := f.AddInline(a, msgidDomain); err != nil {
+				return err
+			}
+		} else {
+			if err := f.AddAttachment(a); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func nonEmpty(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return []string{s}
+}
@@ -0,0 +1,175 @@
+package formatter
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/emersion/go-message"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_ReadJSON(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		Name        string
+		Inp         string
+		Headers     []string
+		Body        string
+		HTML        bool
+		Attachments [][]string
+		Contents    []string
+		Inline      [][]string
+		Err         error
+		ErrStr      string
+	}{
+		{
+			Name:    "Empty object",
+			Inp:     `{}`,
+			Headers: []string{"Content-Type: text/plain; charset=utf-8"},
+			Body:    "",
+		},
+		{
+			Name: "Addresses as strings or lists",
+			Inp:  `{"from": "Alice <alice@example.com>", "to": "bob@example.com", "cc": ["carol@example.com", "dave@example.com"], "bcc": [], "reply_to": "", "subject": "lunch", "text": "hello\nworld\n"}`,
+			Headers: []string{
+				"From: \"Alice\" <alice@example.com>",
+				"To: <bob@example.com>",
+				"Cc: <carol@example.com>, <dave@example.com>",
+				"Subject: lunch",
+				"Content-Type: text/plain; charset=utf-8",
+			},
+			Body: "hello\r\nworld\r\n",
+		},
+		{
+			Name: "Headers sorted with values in order",
+			Inp:  `{"headers": {"x-b": ["1", "2"], "X-A": "0"}, "html": "<p>hello</p>"}`,
+			Headers: []string{
+				"Content-Type: text/plain; charset=utf-8",
+				"X-A: 0",
+				"X-B: 1",
+				"X-B: 2",
+			},
+			Body: "",
+			HTML: true,
+		},
+		{
+			Name:    "Attachments from content",
+			Inp:     `{"html": "<img src=\"a.png\">", "attachments": [{"name": "a.txt", "content": "aGVsbG8="}, {"name": "b", "content_type": "application/pdf", "content": ""}, {"name": "a.png", "content": "iVBORw==", "inline": true}]}`,
+			Headers: []string{"Content-Type: text/plain; charset=utf-8"},
+			Body:    "",
+			HTML:    true,
+			Attachments: [][]string{
+				{"Content-Transfer-Encoding: base64", "Content-Disposition: attachment; filename=a.txt", "Content-Type: text/plain; charset=utf-8; name=a.txt"},
+				{"Content-Transfer-Encoding: base64", "Content-Disposition: attachment; filename=b", "Content-Type: application/pdf; name=b"},
+			},
+			Contents: []string{"hello", ""},
+			Inline: [][]string{
+				{"Content-Id: <>", "Content-Transfer-Encoding: base64", "Content-Disposition: inline; filename=a.png", "Content-Type: image/png; name=a.png"},
+			},
+		},
+		{
+			Name:   "Malformed json",
+			Inp:    `{"to": "bob@example.com",}`,
+			ErrStr: "Failed reading json mail message",
+		},
+		{
+			Name:   "Unknown field",
+			Inp:    `{"body": "hello"}`,
+			ErrStr: "unknown field",
+		},
+		{
+			Name:   "Invalid address list type",
+			Inp:    `{"to": 1}`,
+			ErrStr: "Failed reading json mail message",
+		},
+		{
+			Name:   "Invalid address",
+			Inp:    `{"to": "bob"}`,
+			ErrStr: "Invalid To",
+		},
+		{
+			Name:   "Invalid attachment content",
+			Inp:    `{"attachments": [{"name": "a.txt", "content": "!"}]}`,
+			ErrStr: "Failed reading json mail message",
+		},
+		{
+			Name: "Attachment without a name",
+			Inp:  `{"attachments": [{"content": "aGVsbG8="}]}`,
+			Err:  ErrInvalidAttachment,
+		},
+		{
+			Name: "Attachment without a path or content",
+			Inp:  `{"attachments": [{}]}`,
+			Err:  ErrInvalidAttachment,
+		},
+	} {
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			assert := require.New(t)
+
+			f := New().(*formatter)
+			err := f.ReadJSON(strings.NewReader(tc.Inp), "mail.example.com")
+			if tc.Err != nil {
+				assert.ErrorIs(err, tc.Err)
+				return
+			}
+			if tc.ErrStr != "" {
+				assert.ErrorContains(err, tc.ErrStr)
+				return
+			}
+			assert.NoError(err)
+
+			assert.Equal(tc.Headers, jsonTestFields(f.m.Header))
+			body, err := io.ReadAll(f.m.Body)
+			assert.NoError(err)
+			assert.Equal(tc.Body, string(body))
+			assert.Equal(tc.HTML, f.html != nil)
+
+			var attachments [][]string
+			var contents []string
+			for _, i := range f.attachments {
+				attachments = append(attachments, jsonTestFields(i.Header))
+				b, err := io.ReadAll(i.Body)
+				assert.NoError(err)
+				contents = append(contents, string(b))
+			}
+			assert.Equal(tc.Attachments, attachments)
+			assert.Equal(tc.Contents, contents)
+			var inline [][]string
+			for _, i := range f.inline {
+				assert.True(strings.HasSuffix(i.cid, "@mail.example.com"))
+				h := i.e.Header.Copy()
+				h.Set(headerContentID, "<>")
+				inline = append(inline, jsonTestFields(h))
+			}
+			assert.Equal(tc.Inline, inline)
+		})
+	}
+}
+
+func jsonTestFields(h message.Header) []string {
+	var fields []string
+	i := h.Fields()
+	for i.Next() {
+		fields = append(fields, i.Key()+": "+i.Value())
+	}
+	return fields
+}
+
+func Test_FormatJSON(t *testing.T) {
+	t.Parallel()
+
+	assert := require.New(t)
+
+	var b bytes.Buffer
+	assert.NoError(Format(strings.NewReader(`{"from": "alice@example.com", "to": "bob@example.com", "subject": "lunch", "text": "hello\n\nworld\n", "html": "<p>hello</p>\n<p>world</p>\n", "attachments": [{"name": "a.txt", "content": "aGVsbG8K"}]}`), &b, Opts{
+		JSON:        true,
+		CRLF:        true,
+		MsgIDDomain: "mail.example.com",
+	}))
+	requireCRLF(t, b.String())
+	assert.Contains(b.String(), "\r\n\r\nhello\r\n\r\nworld\r\n")
+}
@@ -0,0 +1,69 @@
+package formatter
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+const (
+	headerListID              = "List-Id"
+	headerListUnsubscribe     = "List-Unsubscribe"
+	headerListUnsubscribePost = "List-Unsubscribe-Post"
+)
+
+const (
+	schemeMailto = "mailto"
+	schemeHTTPS  = "https"
+
+	// listUnsubscribeOneClick is the List-Unsubscribe-Post value of RFC 8058
+	listUnsubscribeOneClick = "List-Unsubscribe=One-Click"
+)
+
+// SetList sets the List-Id of RFC 2919, and List-Unsubscribe of RFC 2369
+// from a mailto address and https url. An https url is unsubscribed with one
+// click per RFC 8058, and so List-Unsubscribe-Post is set as well.
+func (f *formatter) SetList(listID, mailto, httpsURL string) error {
+	if f.m == nil {
+		return ErrNoMsg
+	}
+	if listID != "" {
+		if !strings.HasSuffix(listID, ">") {
+			listID = "<" + listID + ">"
+		}
+		if i := strings.LastIndexByte(listID, '<'); i < 0 || !strings.Contains(listID[i:], ".") {
+			return fmt.Errorf("%w: invalid List-Id %s", ErrInvalidHeader, listID)
+		}
+	}
+	var uris []string
+	if mailto != "" {
+		if !strings.HasPrefix(strings.ToLower(mailto), schemeMailto+":") {
+			mailto = schemeMailto + ":" + mailto
+		}
+		u, err := url.Parse(mailto)
+		if err != nil || u.Opaque == "" {
+			return fmt.Errorf("%w: invalid List-Unsubscribe mailto %s", ErrInvalidHeader, mailto)
+		}
+		uris = append(uris, "<"+u.String()+">")
+	}
+	if httpsURL != "" {
+		u, err := url.Parse(httpsURL)
+		if err != nil || u.Scheme != schemeHTTPS || u.Host == "" {
+			return fmt.Errorf("%w: List-Unsubscribe url must be https: %s", ErrInvalidHeader, httpsURL)
+		}
+		uris = append(uris, "<"+u.String()+">")
+	}
+	// headers are in reverse order of appearance since headers are prepended
+	if len(uris) > 0 {
+		if httpsURL != "" {
+			f.m.Header.Set(headerListUnsubscribePost, listUnsubscribeOneClick)
+		} else {
+			f.m.Header.Del(headerListUnsubscribePost)
+		}
+		f.m.Header.Set(headerListUnsubscribe, strings.Join(uris, ", "))
+	}
+	if listID != "" {
+		f.m.Header.Set(headerListID, listID)
+	}
+	return nil
+}
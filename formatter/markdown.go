@@ -0,0 +1,111 @@
+package formatter
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+	goldmarkhtml "github.com/yuin/goldmark/renderer/html"
+)
+
+var (
+	ErrInvalidBody = errors.New("Invalid body")
+)
+
+// DefaultCSS is the stylesheet of rendered markdown when none is provided
+const DefaultCSS = `body {
+  font-family: -apple-system, BlinkMacSystemFont, "Segoe UI", Helvetica, Arial, sans-serif;
+  font-size: 16px;
+  line-height: 1.5;
+  color: #1f2328;
+}
+h1, h2 {
+  border-bottom: 1px solid #d1d9e0;
+  padding-bottom: 0.3em;
+}
+a {
+  color: #0969da;
+}
+code {
+  font-family: ui-monospace, SFMono-Regular, Menlo, Consolas, monospace;
+  font-size: 85%;
+  background-color: #eff1f3;
+  border-radius: 6px;
+  padding: 0.2em 0.4em;
+}
+pre {
+  background-color: #f6f8fa;
+  border-radius: 6px;
+  padding: 16px;
+  overflow: auto;
+}
+blockquote {
+  color: #59636e;
+  border-left: 0.25em solid #d1d9e0;
+  margin: 0;
+  padding: 0 1em;
+}
+table {
+  border-collapse: collapse;
+}
+th, td {
+  border: 1px solid #d1d9e0;
+  padding: 6px 13px;
+}
+`
+
+var markdown = goldmark.New(
+	goldmark.WithExtensions(extension.GFM),
+	goldmark.WithRendererOptions(
+		// markdown authors may embed html
+		goldmarkhtml.WithUnsafe(),
+	),
+)
+
+// renderMarkdown renders markdown into a full html document with the
+// stylesheet both embedded and inlined into the elements
+func renderMarkdown(src []byte, css string) ([]byte, error) {
+	var body bytes.Buffer
+	if err := markdown.Convert(src, &body); err != nil {
+		return nil, fmt.Errorf("Failed rendering markdown: %w", err)
+	}
+	var doc bytes.Buffer
+	doc.WriteString("<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n")
+	if strings.TrimSpace(css) != "" {
+		doc.WriteString("<style>\n")
+		// style element content is raw text, so only a closing tag must be
+		// prevented
+		doc.WriteString(strings.ReplaceAll(css, "</", "<\\/"))
+		doc.WriteString("\n</style>\n")
+	}
+	doc.WriteString("</head>\n<body>\n")
+	doc.Write(body.Bytes())
+	doc.WriteString("</body>\n</html>\n")
+	return inlineCSS(doc.Bytes(), css)
+}
+
+func (f *formatter) RenderMarkdown(css string) error {
+	if f.m == nil {
+		return ErrNoMsg
+	}
+	if t, _, err := f.m.Header.ContentType(); err == nil && strings.HasPrefix(t, "multipart/") {
+		return fmt.Errorf("%w: markdown body may not be multipart", ErrInvalidBody)
+	}
+	src, err := io.ReadAll(f.m.Body)
+	if err != nil {
+		return fmt.Errorf("Failed reading mail message body: %w", err)
+	}
+	doc, err := renderMarkdown(src, css)
+	if err != nil {
+		return err
+	}
+	f.m.Body = bytes.NewReader(src)
+	f.m.Header.SetContentType(contentTypeTextPlain, map[string]string{
+		paramCharset: charsetUTF8,
+	})
+	return f.SetHTML(bytes.NewReader(doc))
+}
@@ -0,0 +1,335 @@
+package formatter
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/emersion/go-message"
+	emmail "github.com/emersion/go-message/mail"
+	"golang.org/x/text/transform"
+	"xorkevin.dev/mailcat/transformer"
+)
+
+const (
+	replySubjectPrefix   = "Re: "
+	forwardSubjectPrefix = "Fwd: "
+	quotePrefix          = ">"
+)
+
+const (
+	// ForwardInline forwards a message quoted in the body
+	ForwardInline = "inline"
+	// ForwardAttach forwards a message unchanged as a message/rfc822 part
+	ForwardAttach = "attach"
+)
+
+const (
+	contentTypeMessageRFC822 = "message/rfc822"
+)
+
+var errFoundPart = errors.New("Found part")
+
+// textBody returns the first text/plain part of a message that is not an
+// attachment
+func textBody(m *message.Entity) (string, error) {
+	var body string
+	if err := m.Walk(func(path []int, e *message.Entity, err error) error {
+		if err != nil {
+			return err
+		}
+		t, _, err := e.Header.ContentType()
+		if err != nil {
+			return nil
+		}
+		if t == "" && len(path) == 0 {
+			t = contentTypeTextPlain
+		}
+		if t != contentTypeTextPlain {
+			return nil
+		}
+		if disp, _, err := e.Header.ContentDisposition(); err == nil && disp == dispositionAttachment {
+			return nil
+		}
+		b, err := io.ReadAll(e.Body)
+		if err != nil {
+			return fmt.Errorf("Failed reading body: %w", err)
+		}
+		body = string(b)
+		return errFoundPart
+	}); err != nil && !errors.Is(err, errFoundPart) {
+		return "", fmt.Errorf("Failed reading mail message: %w", err)
+	}
+	return body, nil
+}
+
+// quoteBody prefixes every line of the body with a quote marker. Lines are
+// read without a length limit so that long lines are not truncated.
+func quoteBody(w *strings.Builder, body string) error {
+	r := bufio.NewReader(strings.NewReader(body))
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("Failed reading body: %w", err)
+		}
+		if line == "" {
+			return nil
+		}
+		line = strings.TrimRight(line, "\r\n")
+		w.WriteString(quotePrefix)
+		if line != "" && !strings.HasPrefix(line, quotePrefix) {
+			w.WriteString(" ")
+		}
+		w.WriteString(line)
+		w.WriteString("\n")
+	}
+}
+
+// formatAddress formats an address for display in a message body
+func formatAddress(a *emmail.Address) string {
+	if a.Name == "" {
+		return a.Address
+	}
+	return fmt.Sprintf("%s <%s>", a.Name, a.Address)
+}
+
+// prefixSubject prefixes a subject unless it already has the prefix
+func prefixSubject(prefix, subj string) string {
+	// compare without the trailing space
+	p := strings.TrimSpace(prefix)
+	if len(subj) >= len(p) && strings.EqualFold(subj[:len(p)], p) {
+		return subj
+	}
+	return prefix + subj
+}
+
+// excludeAddrs returns addrs without duplicates and without any address in
+// exclude
+func excludeAddrs(addrs []*emmail.Address, exclude []*emmail.Address) []*emmail.Address {
+	seen := map[string]struct{}{}
+	for _, i := range exclude {
+		seen[strings.ToLower(i.Address)] = struct{}{}
+	}
+	var res []*emmail.Address
+	for _, i := range addrs {
+		k := strings.ToLower(i.Address)
+		if _, ok := seen[k]; ok {
+			continue
+		}
+		seen[k] = struct{}{}
+		res = append(res, i)
+	}
+	return res
+}
+
+// Reply replaces the message with a reply to it, addressed to its Reply-To
+// or From, threaded by In-Reply-To and References, and with the original
+// body quoted. If all is set, the original To and Cc addresses other than
+// self are added to Cc.
+func (f *formatter) Reply(all bool, self []*emmail.Address) error {
+	if f.m == nil {
+		return ErrNoMsg
+	}
+	orig := emmail.Header{
+		Header: f.m.Header,
+	}
+	to, err := orig.AddressList(headerReplyTo)
+	if err != nil {
+		return fmt.Errorf("Invalid Reply-To: %w", err)
+	}
+	from, err := orig.AddressList(headerFrom)
+	if err != nil {
+		return fmt.Errorf("Invalid From: %w", err)
+	}
+	if len(to) == 0 {
+		to = from
+	}
+	if len(to) == 0 {
+		return fmt.Errorf("%w: no Reply-To or From to reply to", ErrInvalidHeader)
+	}
+	var cc []*emmail.Address
+	if all {
+		for _, i := range []string{headerTo, headerCc} {
+			addrs, err := orig.AddressList(i)
+			if err != nil {
+				return fmt.Errorf("Invalid %s: %w", i, err)
+			}
+			cc = append(cc, addrs...)
+		}
+		cc = excludeAddrs(cc, append(append([]*emmail.Address{}, to...), self...))
+	}
+	subj, err := orig.Subject()
+	if err != nil {
+		return fmt.Errorf("Invalid Subject: %w", err)
+	}
+	msgid, err := orig.MessageID()
+	if err != nil {
+		return fmt.Errorf("Invalid Message-ID: %w", err)
+	}
+	refs, err := orig.MsgIDList(headerReferences)
+	if err != nil {
+		return fmt.Errorf("Invalid References: %w", err)
+	}
+	if len(refs) == 0 {
+		// per RFC 5322 section 3.6.4, a single In-Reply-To is used when the
+		// parent has no References
+		if replies, err := orig.MsgIDList(headerInReplyTo); err == nil && len(replies) == 1 {
+			refs = replies
+		}
+	}
+	body, err := textBody(f.m)
+	if err != nil {
+		return err
+	}
+
+	var b strings.Builder
+	b.WriteString("\n")
+	if len(from) > 0 {
+		if date := orig.Get(headerDate); date != "" {
+			fmt.Fprintf(&b, "On %s, %s wrote:\n", date, formatAddress(from[0]))
+		} else {
+			fmt.Fprintf(&b, "%s wrote:\n", formatAddress(from[0]))
+		}
+	}
+	if err := quoteBody(&b, body); err != nil {
+		return err
+	}
+
+	headers := emmail.Header{}
+	headers.SetContentType(contentTypeTextPlain, map[string]string{
+		paramCharset: charsetUTF8,
+	})
+	if msgid != "" {
+		headers.SetMsgIDList(headerReferences, append(refs, msgid))
+		headers.SetMsgIDList(headerInReplyTo, []string{msgid})
+	}
+	headers.SetSubject(prefixSubject(replySubjectPrefix, subj))
+	if len(cc) > 0 {
+		headers.SetAddressList(headerCc, cc)
+	}
+	headers.SetAddressList(headerTo, to)
+	m, err := message.New(headers.Header, transform.NewReader(strings.NewReader(b.String()), transformer.CRLF{}))
+	if err != nil {
+		return fmt.Errorf("Failed creating mail message: %w", err)
+	}
+	f.m = m
+	return nil
+}
+
+// Forward replaces the message with a forward of it, with a summary of the
+// original headers and the original body in the body
+func (f *formatter) Forward() error {
+	if f.m == nil {
+		return ErrNoMsg
+	}
+	orig := emmail.Header{
+		Header: f.m.Header,
+	}
+	subj, err := orig.Subject()
+	if err != nil {
+		return fmt.Errorf("Invalid Subject: %w", err)
+	}
+	body, err := textBody(f.m)
+	if err != nil {
+		return err
+	}
+
+	var b strings.Builder
+	b.WriteString("\n---------- Forwarded message ---------\n")
+	for _, i := range []string{headerFrom, headerDate, headerSubject, headerTo, headerCc} {
+		var v string
+		switch i {
+		case headerDate:
+			v = orig.Get(i)
+		case headerSubject:
+			v = subj
+		default:
+			addrs, err := orig.AddressList(i)
+			if err != nil {
+				return fmt.Errorf("Invalid %s: %w", i, err)
+			}
+			k := make([]string, 0, len(addrs))
+			for _, j := range addrs {
+				k = append(k, formatAddress(j))
+			}
+			v = strings.Join(k, ", ")
+		}
+		if v != "" {
+			fmt.Fprintf(&b, "%s: %s\n", i, v)
+		}
+	}
+	b.WriteString("\n")
+	b.WriteString(body)
+	if body != "" && !strings.HasSuffix(body, "\n") {
+		b.WriteString("\n")
+	}
+
+	m, err := newForward(subj, transform.NewReader(strings.NewReader(b.String()), transformer.CRLF{}))
+	if err != nil {
+		return err
+	}
+	f.m = m
+	return nil
+}
+
+// ForwardAttach reads a message and replaces the message with a forward of
+// it, where the original is attached unchanged as a message/rfc822 part so
+// that any signatures of it remain valid
+func (f *formatter) ForwardAttach(r io.Reader) error {
+	raw, err := io.ReadAll(transform.NewReader(r, transformer.CRLF{}))
+	if err != nil {
+		return fmt.Errorf("Failed reading mail message: %w", err)
+	}
+	orig, err := message.Read(bytes.NewReader(raw))
+	if err != nil {
+		return fmt.Errorf("Failed reading mail message: %w", err)
+	}
+	origHeaders := emmail.Header{
+		Header: orig.Header,
+	}
+	subj, err := origHeaders.Subject()
+	if err != nil {
+		return fmt.Errorf("Invalid Subject: %w", err)
+	}
+	m, err := newForward(subj, strings.NewReader(""))
+	if err != nil {
+		return err
+	}
+	e, err := newForwardPart(raw)
+	if err != nil {
+		return err
+	}
+	f.m = m
+	f.attachments = append(f.attachments, e)
+	return nil
+}
+
+// newForwardPart creates a message/rfc822 attachment of the raw message
+func newForwardPart(raw []byte) (*message.Entity, error) {
+	var h message.Header
+	h.SetContentType(contentTypeMessageRFC822, nil)
+	h.Set(headerContentDisposition, dispositionAttachment)
+	// the original is included without a transfer encoding so that it is
+	// written unmodified
+	e, err := message.New(h, bytes.NewReader(raw))
+	if err != nil {
+		return nil, fmt.Errorf("Failed creating mail message part: %w", err)
+	}
+	return e, nil
+}
+
+func newForward(subj string, body io.Reader) (*message.Entity, error) {
+	headers := emmail.Header{}
+	headers.SetContentType(contentTypeTextPlain, map[string]string{
+		paramCharset: charsetUTF8,
+	})
+	headers.SetSubject(prefixSubject(forwardSubjectPrefix, subj))
+	m, err := message.New(headers.Header, body)
+	if err != nil {
+		return nil, fmt.Errorf("Failed creating mail message: %w", err)
+	}
+	return m, nil
+}
@@ -0,0 +1,291 @@
+package formatter
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	emmail "github.com/emersion/go-message/mail"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_PrefixSubject(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		Name   string
+		Prefix string
+		Subj   string
+		Exp    string
+	}{
+		{
+			Name:   "Adds prefix",
+			Prefix: replySubjectPrefix,
+			Subj:   "lunch",
+			Exp:    "Re: lunch",
+		},
+		{
+			Name:   "Keeps existing prefix",
+			Prefix: replySubjectPrefix,
+			Subj:   "Re: lunch",
+			Exp:    "Re: lunch",
+		},
+		{
+			Name:   "Keeps existing prefix of any case",
+			Prefix: replySubjectPrefix,
+			Subj:   "RE: lunch",
+			Exp:    "RE: lunch",
+		},
+		{
+			Name:   "Keeps existing prefix without a space",
+			Prefix: replySubjectPrefix,
+			Subj:   "re:lunch",
+			Exp:    "re:lunch",
+		},
+		{
+			Name:   "Does not match a word with the prefix",
+			Prefix: replySubjectPrefix,
+			Subj:   "Recipe",
+			Exp:    "Re: Recipe",
+		},
+		{
+			Name:   "Prefixes an empty subject",
+			Prefix: replySubjectPrefix,
+			Subj:   "",
+			Exp:    "Re: ",
+		},
+		{
+			Name:   "Prefixes a reply when forwarding",
+			Prefix: forwardSubjectPrefix,
+			Subj:   "Re: lunch",
+			Exp:    "Fwd: Re: lunch",
+		},
+		{
+			Name:   "Keeps existing forward prefix",
+			Prefix: forwardSubjectPrefix,
+			Subj:   "fwd: lunch",
+			Exp:    "fwd: lunch",
+		},
+	} {
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			assert := require.New(t)
+
+			assert.Equal(tc.Exp, prefixSubject(tc.Prefix, tc.Subj))
+		})
+	}
+}
+
+func Test_Reply(t *testing.T) {
+	t.Parallel()
+
+	longLine := strings.Repeat("a", 128*1024)
+
+	for _, tc := range []struct {
+		Name       string
+		Headers    string
+		Body       string
+		References []string
+		InReplyTo  []string
+		Quote      string
+	}{
+		{
+			Name:       "Appends msgid to references",
+			Headers:    "Message-ID: <m3@example.com>\nReferences: <m1@example.com> <m2@example.com>\nIn-Reply-To: <m2@example.com>\n",
+			Body:       "hello\n",
+			References: []string{"m1@example.com", "m2@example.com", "m3@example.com"},
+			InReplyTo:  []string{"m3@example.com"},
+			Quote:      "> hello\n",
+		},
+		{
+			Name:       "Uses a single In-Reply-To without References",
+			Headers:    "Message-ID: <m2@example.com>\nIn-Reply-To: <m1@example.com>\n",
+			Body:       "hello\n> earlier\n\nbye",
+			References: []string{"m1@example.com", "m2@example.com"},
+			InReplyTo:  []string{"m2@example.com"},
+			Quote:      "> hello\n>> earlier\n>\n> bye\n",
+		},
+		{
+			Name:       "Ignores multiple In-Reply-To without References",
+			Headers:    "Message-ID: <m3@example.com>\nIn-Reply-To: <m1@example.com> <m2@example.com>\n",
+			Body:       "hello\n",
+			References: []string{"m3@example.com"},
+			InReplyTo:  []string{"m3@example.com"},
+			Quote:      "> hello\n",
+		},
+		{
+			Name:    "Omits threading without a msgid",
+			Headers: "",
+			Body:    "hello\n",
+			Quote:   "> hello\n",
+		},
+		{
+			Name:       "Quotes long lines in full",
+			Headers:    "Message-ID: <m1@example.com>\n",
+			Body:       longLine + "\n",
+			References: []string{"m1@example.com"},
+			InReplyTo:  []string{"m1@example.com"},
+			Quote:      "> " + longLine + "\n",
+		},
+	} {
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			assert := require.New(t)
+
+			f := New().(*formatter)
+			assert.NoError(f.ReadMsg(strings.NewReader("From: Alice <alice@example.com>\nTo: bob@example.com\nSubject: lunch\n" + tc.Headers + "\n" + tc.Body)))
+			assert.NoError(f.Reply(false, nil))
+
+			headers := emmail.Header{Header: f.m.Header}
+			refs, err := headers.MsgIDList(headerReferences)
+			assert.NoError(err)
+			assert.Equal(tc.References, refs)
+			replies, err := headers.MsgIDList(headerInReplyTo)
+			assert.NoError(err)
+			assert.Equal(tc.InReplyTo, replies)
+			subj, err := headers.Subject()
+			assert.NoError(err)
+			assert.Equal("Re: lunch", subj)
+			to, err := headers.AddressList(headerTo)
+			assert.NoError(err)
+			assert.Equal([]*emmail.Address{{Name: "Alice", Address: "alice@example.com"}}, to)
+
+			body, err := io.ReadAll(f.m.Body)
+			assert.NoError(err)
+			assert.Equal("\nAlice <alice@example.com> wrote:\n"+tc.Quote, strings.ReplaceAll(string(body), "\r\n", "\n"))
+		})
+	}
+}
+
+func Test_ExcludeAddrs(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		Name    string
+		Addrs   []*emmail.Address
+		Exclude []*emmail.Address
+		Exp     []*emmail.Address
+	}{
+		{
+			Name: "Excludes addresses of any case",
+			Addrs: []*emmail.Address{
+				{Name: "Alice", Address: "Alice@Example.com"},
+				{Address: "carol@example.com"},
+			},
+			Exclude: []*emmail.Address{
+				{Address: "alice@example.com"},
+			},
+			Exp: []*emmail.Address{
+				{Address: "carol@example.com"},
+			},
+		},
+		{
+			Name: "Excludes addresses already in To",
+			Addrs: []*emmail.Address{
+				{Address: "bob@example.com"},
+				{Address: "carol@example.com"},
+				{Address: "dave@example.com"},
+			},
+			Exclude: []*emmail.Address{
+				{Name: "Bob", Address: "BOB@example.com"},
+				{Address: "dave@example.com"},
+			},
+			Exp: []*emmail.Address{
+				{Address: "carol@example.com"},
+			},
+		},
+		{
+			Name: "Removes duplicates of any case keeping the first",
+			Addrs: []*emmail.Address{
+				{Name: "Carol", Address: "carol@example.com"},
+				{Address: "dave@example.com"},
+				{Address: "CAROL@example.com"},
+			},
+			Exp: []*emmail.Address{
+				{Name: "Carol", Address: "carol@example.com"},
+				{Address: "dave@example.com"},
+			},
+		},
+		{
+			Name: "Returns nothing when all are excluded",
+			Addrs: []*emmail.Address{
+				{Address: "alice@example.com"},
+			},
+			Exclude: []*emmail.Address{
+				{Address: "ALICE@EXAMPLE.COM"},
+			},
+			Exp: nil,
+		},
+	} {
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			assert := require.New(t)
+
+			assert.Equal(tc.Exp, excludeAddrs(tc.Addrs, tc.Exclude))
+		})
+	}
+}
+
+func Test_ReplyAll(t *testing.T) {
+	t.Parallel()
+
+	assert := require.New(t)
+
+	f := New().(*formatter)
+	assert.NoError(f.ReadMsg(strings.NewReader("From: Alice <alice@example.com>\nReply-To: Alice <ALICE@example.com>\nTo: Bob <bob@example.com>, carol@example.com\nCc: alice@example.com, Carol@Example.com, dave@example.com\nSubject: lunch\n\nhello\n")))
+	assert.NoError(f.Reply(true, []*emmail.Address{{Address: "BOB@example.com"}}))
+
+	headers := emmail.Header{Header: f.m.Header}
+	to, err := headers.AddressList(headerTo)
+	assert.NoError(err)
+	assert.Equal([]*emmail.Address{{Name: "Alice", Address: "ALICE@example.com"}}, to)
+	cc, err := headers.AddressList(headerCc)
+	assert.NoError(err)
+	assert.Equal([]*emmail.Address{{Address: "carol@example.com"}, {Address: "dave@example.com"}}, cc)
+}
+
+// requireCRLF requires every line of a message to end in CRLF
+func requireCRLF(t *testing.T, msg string) {
+	t.Helper()
+	assert := require.New(t)
+
+	assert.True(strings.HasSuffix(msg, "\r\n"))
+	lines := strings.Split(strings.TrimSuffix(msg, "\r\n"), "\r\n")
+	for n, i := range lines {
+		assert.NotContains(i, "\n", "line %d is not CRLF terminated", n)
+		assert.NotContains(i, "\r", "line %d is not CRLF terminated", n)
+	}
+}
+
+func Test_ReplyCRLF(t *testing.T) {
+	t.Parallel()
+
+	assert := require.New(t)
+
+	var b bytes.Buffer
+	assert.NoError(Format(strings.NewReader("From: Alice <alice@example.com>\nTo: bob@example.com\nSubject: lunch\nMessage-ID: <m1@example.com>\nDate: Sat, 01 Jan 2000 00:00:00 +0000\n\nhello\n\nbye\n"), &b, Opts{
+		Reply:       true,
+		Headers:     []string{"From: bob@example.com"},
+		CRLF:        true,
+		MsgIDDomain: "mail.example.com",
+	}))
+	requireCRLF(t, b.String())
+	assert.Contains(b.String(), "\r\n\r\n\r\nOn Sat, 01 Jan 2000 00:00:00 +0000, Alice <alice@example.com> wrote:\r\n> hello\r\n>\r\n> bye\r\n")
+}
+
+func Test_ForwardCRLF(t *testing.T) {
+	t.Parallel()
+
+	assert := require.New(t)
+
+	var b bytes.Buffer
+	assert.NoError(Format(strings.NewReader("From: Alice <alice@example.com>\nTo: bob@example.com\nSubject: lunch\nDate: Sat, 01 Jan 2000 00:00:00 +0000\n\nhello\n\nbye\n"), &b, Opts{
+		Forward:     ForwardInline,
+		Headers:     []string{"From: bob@example.com", "To: carol@example.com"},
+		CRLF:        true,
+		MsgIDDomain: "mail.example.com",
+	}))
+	requireCRLF(t, b.String())
+	assert.Contains(b.String(), "\r\n\r\n\r\n---------- Forwarded message ---------\r\nFrom: Alice <alice@example.com>\r\nDate: Sat, 01 Jan 2000 00:00:00 +0000\r\nSubject: lunch\r\nTo: bob@example.com\r\n\r\nhello\r\n\r\nbye\r\n")
+}
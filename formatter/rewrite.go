@@ -0,0 +1,90 @@
+package formatter
+
+import (
+	"fmt"
+	"net/textproto"
+	"path"
+	"strings"
+
+	"github.com/emersion/go-message"
+)
+
+// headerMatcher matches header keys case insensitively against glob patterns
+type headerMatcher []string
+
+func newHeaderMatcher(patterns []string) (headerMatcher, error) {
+	m := make(headerMatcher, 0, len(patterns))
+	for _, i := range patterns {
+		p := strings.ToLower(strings.TrimSpace(i))
+		if _, err := path.Match(p, ""); err != nil || p == "" {
+			return nil, fmt.Errorf("%w: pattern %s", ErrInvalidHeader, i)
+		}
+		m = append(m, p)
+	}
+	return m, nil
+}
+
+func (m headerMatcher) match(key string) bool {
+	k := strings.ToLower(key)
+	for _, i := range m {
+		if ok, _ := path.Match(i, k); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// deleteHeaders deletes all headers matching m and returns the canonical keys
+// of the deleted headers in order of appearance
+func deleteHeaders(h *message.Header, m headerMatcher) []string {
+	var keys []string
+	seen := map[string]struct{}{}
+	fields := h.Fields()
+	for fields.Next() {
+		if !m.match(fields.Key()) {
+			continue
+		}
+		k := textproto.CanonicalMIMEHeaderKey(fields.Key())
+		if _, ok := seen[k]; !ok {
+			seen[k] = struct{}{}
+			keys = append(keys, k)
+		}
+		fields.Del()
+	}
+	return keys
+}
+
+// RewriteHeaders removes headers matching the glob patterns of remove, and
+// then for each HEADER:VALUE of replace, overrides all headers matching the
+// HEADER glob with the value, setting it if none match and HEADER is not a
+// glob
+func (f *formatter) RewriteHeaders(remove, replace []string) error {
+	if f.m == nil {
+		return ErrNoMsg
+	}
+	rm, err := newHeaderMatcher(remove)
+	if err != nil {
+		return err
+	}
+	deleteHeaders(&f.m.Header, rm)
+	for _, i := range replace {
+		k, v, ok := strings.Cut(i, ":")
+		if !ok {
+			return fmt.Errorf("%w: %s", ErrInvalidHeader, i)
+		}
+		k = strings.TrimSpace(k)
+		v = strings.TrimSpace(v)
+		m, err := newHeaderMatcher([]string{k})
+		if err != nil {
+			return err
+		}
+		keys := deleteHeaders(&f.m.Header, m)
+		if len(keys) == 0 && !strings.ContainsAny(k, `*?[\`) {
+			keys = []string{textproto.CanonicalMIMEHeaderKey(k)}
+		}
+		for _, j := range keys {
+			f.m.Header.Set(j, v)
+		}
+	}
+	return nil
+}
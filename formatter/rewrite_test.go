@@ -0,0 +1,104 @@
+package formatter
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_RewriteHeaders(t *testing.T) {
+	t.Parallel()
+
+	const inp = "From: alice@example.com\nTo: bob@example.com\nSubject: lunch\nX-Mailer: a\nX-Spam-Score: 1\nx-spam-flag: YES\nReceived: r2\nReceived: r1\n\nhello\n"
+
+	for _, tc := range []struct {
+		Name    string
+		Remove  []string
+		Replace []string
+		Exp     []string
+		Err     error
+	}{
+		{
+			Name:   "Removes headers matching a wildcard of any case",
+			Remove: []string{"X-SPAM-*"},
+			Exp:    []string{"From: alice@example.com", "To: bob@example.com", "Subject: lunch", "X-Mailer: a", "Received: r2", "Received: r1"},
+		},
+		{
+			Name:   "Removes every header with a key",
+			Remove: []string{"received", "x-?ailer"},
+			Exp:    []string{"From: alice@example.com", "To: bob@example.com", "Subject: lunch", "X-Spam-Score: 1", "X-Spam-Flag: YES"},
+		},
+		{
+			Name:   "Removes headers matching a character class",
+			Remove: []string{"[tf]*"},
+			Exp:    []string{"Subject: lunch", "X-Mailer: a", "X-Spam-Score: 1", "X-Spam-Flag: YES", "Received: r2", "Received: r1"},
+		},
+		{
+			Name:    "Replaces all headers matching a wildcard",
+			Replace: []string{"x-spam-*: 0"},
+			Exp:     []string{"X-Spam-Flag: 0", "X-Spam-Score: 0", "From: alice@example.com", "To: bob@example.com", "Subject: lunch", "X-Mailer: a", "Received: r2", "Received: r1"},
+		},
+		{
+			Name:    "Replaces repeated headers with a single value",
+			Replace: []string{"RECEIVED: r0"},
+			Exp:     []string{"Received: r0", "From: alice@example.com", "To: bob@example.com", "Subject: lunch", "X-Mailer: a", "X-Spam-Score: 1", "X-Spam-Flag: YES"},
+		},
+		{
+			Name:    "Sets a missing header that is not a glob",
+			Replace: []string{"reply-to: carol@example.com"},
+			Exp:     []string{"Reply-To: carol@example.com", "From: alice@example.com", "To: bob@example.com", "Subject: lunch", "X-Mailer: a", "X-Spam-Score: 1", "X-Spam-Flag: YES", "Received: r2", "Received: r1"},
+		},
+		{
+			Name:    "Does not set a missing header that is a glob",
+			Replace: []string{"X-Other-*: 0"},
+			Exp:     []string{"From: alice@example.com", "To: bob@example.com", "Subject: lunch", "X-Mailer: a", "X-Spam-Score: 1", "X-Spam-Flag: YES", "Received: r2", "Received: r1"},
+		},
+		{
+			Name:    "Removes before replacing",
+			Remove:  []string{"subject"},
+			Replace: []string{"Subject: dinner"},
+			Exp:     []string{"Subject: dinner", "From: alice@example.com", "To: bob@example.com", "X-Mailer: a", "X-Spam-Score: 1", "X-Spam-Flag: YES", "Received: r2", "Received: r1"},
+		},
+		{
+			Name:    "Replaces in order with later replacements winning",
+			Replace: []string{"x-spam-*: 0", "X-Spam-Flag: NO"},
+			Exp:     []string{"X-Spam-Flag: NO", "X-Spam-Score: 0", "From: alice@example.com", "To: bob@example.com", "Subject: lunch", "X-Mailer: a", "Received: r2", "Received: r1"},
+		},
+		{
+			Name:   "Rejects an invalid pattern",
+			Remove: []string{"x-["},
+			Err:    ErrInvalidHeader,
+		},
+		{
+			Name:   "Rejects an empty pattern",
+			Remove: []string{" "},
+			Err:    ErrInvalidHeader,
+		},
+		{
+			Name:    "Rejects a replacement without a value",
+			Replace: []string{"Subject"},
+			Err:     ErrInvalidHeader,
+		},
+	} {
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			assert := require.New(t)
+
+			f := New()
+			assert.NoError(f.ReadMsg(strings.NewReader(inp)))
+			err := f.RewriteHeaders(tc.Remove, tc.Replace)
+			if tc.Err != nil {
+				assert.ErrorIs(err, tc.Err)
+				return
+			}
+			assert.NoError(err)
+			var headers []string
+			fields := f.(*formatter).m.Header.Fields()
+			for fields.Next() {
+				headers = append(headers, fields.Key()+": "+fields.Value())
+			}
+			assert.Equal(tc.Exp, headers)
+		})
+	}
+}
@@ -0,0 +1,132 @@
+package formatter
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	ErrInvalidTemplate = errors.New("Invalid template")
+)
+
+// ParseTemplate parses a message template, where both the header block and
+// body are rendered with text/template
+func ParseTemplate(r io.Reader) (*template.Template, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("Failed reading template: %w", err)
+	}
+	t, err := template.New("msg").Option("missingkey=error").Parse(string(b))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidTemplate, err)
+	}
+	return t, nil
+}
+
+// ExecTemplate renders a message template with data. Data rendered into the
+// header block may not contain line breaks, which would otherwise inject
+// headers.
+func ExecTemplate(t *template.Template, data any) (io.Reader, error) {
+	var b bytes.Buffer
+	if err := t.Execute(&b, data); err != nil {
+		return nil, fmt.Errorf("Failed executing template: %w", err)
+	}
+	// the header block is rendered again with the line breaks of the data
+	// removed, and any difference is from line breaks in the rendered data
+	var s bytes.Buffer
+	if err := t.Execute(&s, stripLineBreaks(data)); err != nil {
+		return nil, fmt.Errorf("Failed executing template: %w", err)
+	}
+	if !bytes.Equal(headerBlock(b.Bytes()), headerBlock(s.Bytes())) {
+		return nil, fmt.Errorf("%w: template data rendered in headers may not contain line breaks", ErrInvalidHeader)
+	}
+	return &b, nil
+}
+
+// lineBreakReplacer replaces line breaks with spaces
+var lineBreakReplacer = strings.NewReplacer("\r", " ", "\n", " ")
+
+// stripLineBreaks returns a copy of template data with the line breaks of its
+// strings replaced with spaces
+func stripLineBreaks(data any) any {
+	switch v := data.(type) {
+	case string:
+		return lineBreakReplacer.Replace(v)
+	case map[string]any:
+		m := make(map[string]any, len(v))
+		for k, i := range v {
+			m[k] = stripLineBreaks(i)
+		}
+		return m
+	case map[string]string:
+		m := make(map[string]string, len(v))
+		for k, i := range v {
+			m[k] = lineBreakReplacer.Replace(i)
+		}
+		return m
+	case []any:
+		s := make([]any, 0, len(v))
+		for _, i := range v {
+			s = append(s, stripLineBreaks(i))
+		}
+		return s
+	case []string:
+		s := make([]string, 0, len(v))
+		for _, i := range v {
+			s = append(s, lineBreakReplacer.Replace(i))
+		}
+		return s
+	default:
+		return data
+	}
+}
+
+// headerBlock returns the header block of a message up to the first empty
+// line
+func headerBlock(b []byte) []byte {
+	b = bytes.ReplaceAll(b, []byte("\r\n"), []byte("\n"))
+	if i := bytes.Index(b, []byte("\n\n")); i >= 0 {
+		return b[:i]
+	}
+	return b
+}
+
+// ReadTemplateData reads template data from a JSON or YAML file, if file is
+// not empty, and sets key=value vars over it
+func ReadTemplateData(file string, vars []string) (map[string]any, error) {
+	data := map[string]any{}
+	if file != "" {
+		b, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("Failed reading file %s: %w", file, err)
+		}
+		if strings.EqualFold(filepath.Ext(file), ".json") {
+			err = json.Unmarshal(b, &data)
+		} else {
+			err = yaml.Unmarshal(b, &data)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Failed parsing template data %s: %w", file, err)
+		}
+		if data == nil {
+			data = map[string]any{}
+		}
+	}
+	for _, i := range vars {
+		k, v, ok := strings.Cut(i, "=")
+		if !ok {
+			return nil, fmt.Errorf("%w: var %s", ErrInvalidTemplate, i)
+		}
+		data[strings.TrimSpace(k)] = v
+	}
+	return data, nil
+}
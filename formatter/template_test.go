@@ -0,0 +1,81 @@
+package formatter
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_ExecTemplate(t *testing.T) {
+	t.Parallel()
+
+	tmpl := `From: a@example.com
+To: {{.to}}
+Subject: {{.subject}}
+
+{{.body}}
+`
+
+	for _, tc := range []struct {
+		Name string
+		Data map[string]any
+		Out  string
+		Err  error
+	}{
+		{
+			Name: "Line breaks in body",
+			Data: map[string]any{
+				"to":      "b@example.com",
+				"subject": "hi",
+				"body":    "line one\nline two",
+			},
+			Out: "From: a@example.com\nTo: b@example.com\nSubject: hi\n\nline one\nline two\n",
+		},
+		{
+			Name: "Injected header",
+			Data: map[string]any{
+				"to":      "b@example.com",
+				"subject": "hi\nBcc: c@example.com",
+				"body":    "hello",
+			},
+			Err: ErrInvalidHeader,
+		},
+		{
+			Name: "Injected body",
+			Data: map[string]any{
+				"to":      "b@example.com\r\n\r\nspoofed",
+				"subject": "hi",
+				"body":    "hello",
+			},
+			Err: ErrInvalidHeader,
+		},
+		{
+			Name: "Continuation line",
+			Data: map[string]any{
+				"to":      "b@example.com",
+				"subject": "hi\n there",
+				"body":    "hello",
+			},
+			Err: ErrInvalidHeader,
+		},
+	} {
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			assert := require.New(t)
+
+			pt, err := ParseTemplate(strings.NewReader(tmpl))
+			assert.NoError(err)
+			r, err := ExecTemplate(pt, tc.Data)
+			if tc.Err != nil {
+				assert.ErrorIs(err, tc.Err)
+				return
+			}
+			assert.NoError(err)
+			b, err := io.ReadAll(r)
+			assert.NoError(err)
+			assert.Equal(tc.Out, string(b))
+		})
+	}
+}
@@ -0,0 +1,165 @@
+package inspect
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"mime/quotedprintable"
+	"strings"
+
+	"github.com/emersion/go-message"
+	"github.com/emersion/go-message/textproto"
+	"golang.org/x/text/transform"
+	"xorkevin.dev/mailcat/transformer"
+)
+
+const (
+	encoding7bit            = "7bit"
+	encoding8bit            = "8bit"
+	encodingBinary          = "binary"
+	encodingQuotedPrintable = "quoted-printable"
+	encodingBase64          = "base64"
+)
+
+const (
+	// maxLineLen is the maximum line length of RFC 5322 excluding CRLF
+	maxLineLen = 998
+)
+
+// Decode reads a message from r and writes it to w with the transfer
+// encoding of every part decoded, leaving charsets unchanged. Decoded parts
+// are labeled 7bit, 8bit, or binary by their content. The message is written
+// with CRLF line endings, since decoded binary parts may not have their line
+// endings changed.
+func Decode(r io.Reader, w io.Writer) error {
+	br := bufio.NewReader(transform.NewReader(r, transformer.CRLF{}))
+	if err := decodeMsg(br, w, 0); err != nil {
+		return err
+	}
+	return nil
+}
+
+func decodeMsg(r *bufio.Reader, w io.Writer, depth int) error {
+	h, err := textproto.ReadHeader(r)
+	if err != nil {
+		return fmt.Errorf("Failed reading mail message header: %w", err)
+	}
+	var b bytes.Buffer
+	if err := decodeEntity(message.Header{Header: h}, r, &b, depth); err != nil {
+		return err
+	}
+	if err := textproto.WriteHeader(w, h); err != nil {
+		return fmt.Errorf("Failed writing header: %w", err)
+	}
+	if _, err := w.Write(b.Bytes()); err != nil {
+		return fmt.Errorf("Failed writing body: %w", err)
+	}
+	return nil
+}
+
+// decodeEntity writes the decoded body of an entity to w, and sets the
+// transfer encoding of its header h to that of the decoded body
+func decodeEntity(h message.Header, r *bufio.Reader, w io.Writer, depth int) error {
+	if depth > maxDepth {
+		return fmt.Errorf("Message exceeds max depth %d", maxDepth)
+	}
+	t, params, _ := h.ContentType()
+	if strings.HasPrefix(t, contentTypeMultipart) && params[paramBoundary] != "" {
+		// multipart entities may not be encoded
+		mw := textproto.NewMultipartWriter(w)
+		if err := mw.SetBoundary(params[paramBoundary]); err != nil {
+			return fmt.Errorf("Invalid boundary: %w", err)
+		}
+		mr := textproto.NewMultipartReader(r, params[paramBoundary])
+		for {
+			p, err := mr.NextPart()
+			if err != nil {
+				if errors.Is(err, io.EOF) {
+					break
+				}
+				return fmt.Errorf("Failed reading multipart: %w", err)
+			}
+			ph := message.Header{
+				Header: p.Header,
+			}
+			var b bytes.Buffer
+			if err := decodeEntity(ph, bufio.NewReader(p), &b, depth+1); err != nil {
+				return err
+			}
+			pw, err := mw.CreatePart(ph.Header)
+			if err != nil {
+				return fmt.Errorf("Failed writing part: %w", err)
+			}
+			if _, err := pw.Write(b.Bytes()); err != nil {
+				return fmt.Errorf("Failed writing part: %w", err)
+			}
+		}
+		if err := mw.Close(); err != nil {
+			return fmt.Errorf("Failed writing multipart: %w", err)
+		}
+		return nil
+	}
+	var body io.Reader = r
+	enc := strings.ToLower(strings.TrimSpace(h.Get(headerContentTransferEncoding)))
+	switch enc {
+	case "", encoding7bit, encoding8bit, encodingBinary:
+		if t != contentTypeMessageRFC822 {
+			if _, err := io.Copy(w, r); err != nil {
+				return fmt.Errorf("Failed writing body: %w", err)
+			}
+			return nil
+		}
+	case encodingQuotedPrintable:
+		body = quotedprintable.NewReader(r)
+	case encodingBase64:
+		body = base64.NewDecoder(base64.StdEncoding, r)
+	default:
+		// bodies of unknown encodings are left unchanged
+		if _, err := io.Copy(w, r); err != nil {
+			return fmt.Errorf("Failed writing body: %w", err)
+		}
+		return nil
+	}
+	b, err := io.ReadAll(body)
+	if err != nil {
+		return fmt.Errorf("Failed decoding body: %w", err)
+	}
+	if t == contentTypeMessageRFC822 {
+		var m bytes.Buffer
+		if err := decodeMsg(bufio.NewReader(bytes.NewReader(b)), &m, depth+1); err != nil {
+			return err
+		}
+		b = m.Bytes()
+	}
+	h.Set(headerContentTransferEncoding, bodyEncoding(b))
+	if _, err := w.Write(b); err != nil {
+		return fmt.Errorf("Failed writing body: %w", err)
+	}
+	return nil
+}
+
+// bodyEncoding returns the most restrictive transfer encoding of an unencoded
+// body by its 8-bit data and line lengths
+func bodyEncoding(b []byte) string {
+	enc := encoding7bit
+	lineLen := 0
+	for _, i := range b {
+		switch {
+		case i == 0:
+			return encodingBinary
+		case i == '\r' || i == '\n':
+			lineLen = 0
+			continue
+		case i >= 0x80:
+			enc = encoding8bit
+		}
+		lineLen++
+		if lineLen > maxLineLen {
+			return encodingBinary
+		}
+	}
+	return enc
+}
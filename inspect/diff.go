@@ -0,0 +1,438 @@
+package inspect
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/textproto"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-message"
+	emmail "github.com/emersion/go-message/mail"
+	"golang.org/x/text/transform"
+	"xorkevin.dev/mailcat/transformer"
+)
+
+type (
+	DiffOpts struct {
+		// Ignore are case insensitive globs of headers to ignore
+		Ignore []string
+		// IgnoreVolatile ignores headers that differ on every generated
+		// message such as Message-ID and Date
+		IgnoreVolatile bool
+	}
+
+	// diffMsg is a message normalized for comparison
+	diffMsg struct {
+		keys    []string
+		headers map[string][]string
+		parts   []diffPart
+	}
+
+	diffPart struct {
+		path    string
+		desc    string
+		text    bool
+		content []byte
+	}
+
+	differ struct {
+		b     strings.Builder
+		count int
+	}
+)
+
+var (
+	ErrDiff = errors.New("Messages differ")
+)
+
+const (
+	headerMsgID         = "Message-Id"
+	headerContentID     = "Content-Id"
+	headerDKIMSignature = "Dkim-Signature"
+	headerReceived      = "Received"
+)
+
+// volatileHeaders differ on every generated message
+var volatileHeaders = []string{
+	headerMsgID,
+	headerContentID,
+	headerDate,
+	headerDKIMSignature,
+	headerReceived,
+}
+
+const (
+	// maxDiffCells bounds the work of a line diff of text parts
+	maxDiffCells = 1 << 22
+)
+
+// DiffFiles compares the messages in files a and b
+func DiffFiles(a, b string, w io.Writer, opts DiffOpts) (retErr error) {
+	fa, err := os.Open(a)
+	if err != nil {
+		return fmt.Errorf("Failed to open file %s: %w", a, err)
+	}
+	defer func() {
+		if err := fa.Close(); err != nil {
+			retErr = errors.Join(retErr, fmt.Errorf("Failed closing file %s: %w", a, err))
+		}
+	}()
+	fb, err := os.Open(b)
+	if err != nil {
+		return fmt.Errorf("Failed to open file %s: %w", b, err)
+	}
+	defer func() {
+		if err := fb.Close(); err != nil {
+			retErr = errors.Join(retErr, fmt.Errorf("Failed closing file %s: %w", b, err))
+		}
+	}()
+	return Diff(fa, fb, w, opts)
+}
+
+// Diff compares messages semantically, comparing headers by their parsed
+// values and parts by their decoded content, and writes the differences to
+// w. It returns ErrDiff if the messages differ.
+func Diff(a, b io.Reader, w io.Writer, opts DiffOpts) error {
+	ignore := make([]string, 0, len(opts.Ignore)+len(volatileHeaders)+1)
+	for _, i := range opts.Ignore {
+		p := strings.ToLower(strings.TrimSpace(i))
+		if _, err := path.Match(p, ""); err != nil || p == "" {
+			return fmt.Errorf("%w: invalid header pattern %s", ErrInvalidArgs, i)
+		}
+		ignore = append(ignore, p)
+	}
+	// transfer encodings are compared by the decoded content of parts
+	ignore = append(ignore, strings.ToLower(headerContentTransferEncoding))
+	if opts.IgnoreVolatile {
+		for _, i := range volatileHeaders {
+			ignore = append(ignore, strings.ToLower(i))
+		}
+	}
+	ma, err := readDiffMsg(a, ignore, opts.IgnoreVolatile)
+	if err != nil {
+		return err
+	}
+	mb, err := readDiffMsg(b, ignore, opts.IgnoreVolatile)
+	if err != nil {
+		return err
+	}
+	d := &differ{}
+	d.diffHeaders(ma, mb)
+	d.diffParts(ma.parts, mb.parts)
+	if _, err := io.WriteString(w, d.b.String()); err != nil {
+		return fmt.Errorf("Failed writing diff: %w", err)
+	}
+	if d.count > 0 {
+		return fmt.Errorf("%w: %d differences", ErrDiff, d.count)
+	}
+	return nil
+}
+
+func matchAny(patterns []string, key string) bool {
+	k := strings.ToLower(key)
+	for _, i := range patterns {
+		if ok, _ := path.Match(i, k); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func readDiffMsg(r io.Reader, ignore []string, volatile bool) (*diffMsg, error) {
+	e, err := message.Read(transform.NewReader(r, transformer.CRLF{}))
+	if err != nil && !message.IsUnknownCharset(err) && !message.IsUnknownEncoding(err) {
+		return nil, fmt.Errorf("Failed reading mail message: %w", err)
+	}
+	m := &diffMsg{
+		headers: map[string][]string{},
+	}
+	// cids maps Content-IDs to the parts that declare them
+	cids := map[string]string{}
+	fields := e.Header.Fields()
+	for fields.Next() {
+		k := textproto.CanonicalMIMEHeaderKey(fields.Key())
+		if matchAny(ignore, k) {
+			continue
+		}
+		if _, ok := m.headers[k]; !ok {
+			m.keys = append(m.keys, k)
+		}
+		m.headers[k] = append(m.headers[k], normHeader(k, fields.Value()))
+	}
+	sort.Strings(m.keys)
+	for _, k := range m.keys {
+		if isAddrHeader(k) {
+			// recipients are compared irrespective of order
+			sort.Strings(m.headers[k])
+		}
+	}
+	if err := Walk(e, func(path string, p *message.Entity, _ error) (bool, error) {
+		t, params, _ := p.Header.ContentType()
+		if t == "" {
+			t = contentTypeTextPlain
+		}
+		if strings.HasPrefix(t, contentTypeMultipart) {
+			m.parts = append(m.parts, diffPart{
+				path: path,
+				desc: t,
+			})
+			return true, nil
+		}
+		if t == contentTypeMessageRFC822 {
+			m.parts = append(m.parts, diffPart{
+				path: path,
+				desc: t,
+			})
+			return true, nil
+		}
+		desc := t
+		if c := params[paramCharset]; c != "" {
+			desc += " charset=" + strings.ToLower(c)
+		}
+		if cid := strings.Trim(strings.TrimSpace(p.Header.Get(headerContentID)), "<>"); cid != "" {
+			cids[cid] = path
+		}
+		disp, dispParams, _ := p.Header.ContentDisposition()
+		if disp != "" {
+			desc += " disposition=" + disp
+		}
+		name := dispParams[paramFilename]
+		if name == "" {
+			name = params[paramName]
+		}
+		if name != "" {
+			desc += fmt.Sprintf(" filename=%q", name)
+		}
+		b, err := io.ReadAll(p.Body)
+		if err != nil {
+			return false, fmt.Errorf("Failed reading part %s: %w", path, err)
+		}
+		text := strings.HasPrefix(t, contentTypeText)
+		if text {
+			b = bytes.ReplaceAll(b, []byte("\r\n"), []byte("\n"))
+		}
+		m.parts = append(m.parts, diffPart{
+			path:    path,
+			desc:    desc,
+			text:    text,
+			content: b,
+		})
+		return false, nil
+	}); err != nil {
+		return nil, err
+	}
+	if volatile && len(cids) > 0 {
+		// Content-IDs are generated, so references to them are compared by
+		// the parts they reference
+		pairs := make([]string, 0, len(cids)*2)
+		for k, v := range cids {
+			pairs = append(pairs, "cid:"+k, "cid:"+partName(v))
+		}
+		r := strings.NewReplacer(pairs...)
+		for n, i := range m.parts {
+			if i.text {
+				m.parts[n].content = []byte(r.Replace(string(i.content)))
+			}
+		}
+	}
+	return m, nil
+}
+
+func isAddrHeader(k string) bool {
+	switch k {
+	case headerFrom, headerSender, headerReplyTo, headerTo, headerCc, headerBcc:
+		return true
+	}
+	return false
+}
+
+// normHeader normalizes a header value by its parsed meaning, falling back
+// to its decoded text with whitespace collapsed
+func normHeader(k, v string) string {
+	h := emmail.Header{}
+	h.Set(k, v)
+	switch {
+	case isAddrHeader(k):
+		if addrs, err := h.AddressList(k); err == nil {
+			s := make([]string, 0, len(addrs))
+			for _, i := range addrs {
+				a := strings.ToLower(i.Address)
+				if i.Name != "" {
+					a = fmt.Sprintf("%s <%s>", i.Name, a)
+				}
+				s = append(s, a)
+			}
+			sort.Strings(s)
+			return strings.Join(s, ", ")
+		}
+	case k == headerDate:
+		if t, err := h.Date(); err == nil {
+			return t.UTC().Format(time.RFC3339)
+		}
+	case k == headerMsgID, k == headerInReplyTo, k == headerReferences, k == headerContentID:
+		if ids, err := h.MsgIDList(k); err == nil {
+			return strings.Join(ids, " ")
+		}
+	case k == headerContentType:
+		if t, params, err := h.ContentType(); err == nil {
+			// boundaries are generated
+			delete(params, paramBoundary)
+			if c, ok := params[paramCharset]; ok {
+				params[paramCharset] = strings.ToLower(c)
+			}
+			return mime.FormatMediaType(t, params)
+		}
+	}
+	if s, err := h.Text(k); err == nil {
+		v = s
+	}
+	return strings.Join(strings.Fields(v), " ")
+}
+
+func (d *differ) diffHeaders(a, b *diffMsg) {
+	keys := append([]string{}, a.keys...)
+	for _, k := range b.keys {
+		if _, ok := a.headers[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		va, vb := a.headers[k], b.headers[k]
+		if slicesEqual(va, vb) {
+			continue
+		}
+		d.count++
+		fmt.Fprintf(&d.b, "header %s:\n", k)
+		for _, i := range va {
+			fmt.Fprintf(&d.b, "- %s\n", i)
+		}
+		for _, i := range vb {
+			fmt.Fprintf(&d.b, "+ %s\n", i)
+		}
+	}
+}
+
+func slicesEqual(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for n, i := range a {
+		if b[n] != i {
+			return false
+		}
+	}
+	return true
+}
+
+func partName(p string) string {
+	if p == "" {
+		return "message"
+	}
+	return p
+}
+
+func (d *differ) diffParts(a, b []diffPart) {
+	pb := make(map[string]diffPart, len(b))
+	for _, i := range b {
+		pb[i.path] = i
+	}
+	seen := make(map[string]struct{}, len(a))
+	for _, i := range a {
+		seen[i.path] = struct{}{}
+		j, ok := pb[i.path]
+		if !ok {
+			d.count++
+			fmt.Fprintf(&d.b, "part %s:\n- %s\n", partName(i.path), i.desc)
+			continue
+		}
+		if i.desc != j.desc {
+			d.count++
+			fmt.Fprintf(&d.b, "part %s:\n- %s\n+ %s\n", partName(i.path), i.desc, j.desc)
+			continue
+		}
+		if bytes.Equal(i.content, j.content) {
+			continue
+		}
+		d.count++
+		fmt.Fprintf(&d.b, "part %s %s content:\n", partName(i.path), i.desc)
+		if i.text && j.text {
+			d.diffLines(string(i.content), string(j.content))
+		} else {
+			fmt.Fprintf(&d.b, "- %d bytes sha256 %x\n+ %d bytes sha256 %x\n", len(i.content), sha256.Sum256(i.content), len(j.content), sha256.Sum256(j.content))
+		}
+	}
+	for _, j := range b {
+		if _, ok := seen[j.path]; !ok {
+			d.count++
+			fmt.Fprintf(&d.b, "part %s:\n+ %s\n", partName(j.path), j.desc)
+		}
+	}
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.SplitAfter(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// diffLines writes a line diff of a and b by their longest common
+// subsequence
+func (d *differ) diffLines(a, b string) {
+	la := splitLines(a)
+	lb := splitLines(b)
+	if len(la)*len(lb) > maxDiffCells {
+		fmt.Fprintf(&d.b, "- %d lines\n+ %d lines\n", len(la), len(lb))
+		return
+	}
+	// lcs[i][j] is the length of the longest common subsequence of la[i:]
+	// and lb[j:]
+	lcs := make([][]int, len(la)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(lb)+1)
+	}
+	for i := len(la) - 1; i >= 0; i-- {
+		for j := len(lb) - 1; j >= 0; j-- {
+			if la[i] == lb[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+	writeLine := func(prefix, line string) {
+		d.b.WriteString(prefix)
+		d.b.WriteString(strings.TrimSuffix(line, "\n"))
+		d.b.WriteString("\n")
+	}
+	i, j := 0, 0
+	for i < len(la) && j < len(lb) {
+		switch {
+		case la[i] == lb[j]:
+			writeLine("  ", la[i])
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			writeLine("- ", la[i])
+			i++
+		default:
+			writeLine("+ ", lb[j])
+			j++
+		}
+	}
+	for ; i < len(la); i++ {
+		writeLine("- ", la[i])
+	}
+	for ; j < len(lb); j++ {
+		writeLine("+ ", lb[j])
+	}
+}
@@ -0,0 +1,172 @@
+package inspect
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	"github.com/emersion/go-message"
+	"golang.org/x/text/transform"
+	"xorkevin.dev/mailcat/transformer"
+)
+
+type (
+	ExtractOpts struct {
+		Dir  string
+		Text bool
+		Path string
+	}
+)
+
+var (
+	ErrInvalidArgs  = errors.New("Invalid args")
+	ErrPartNotFound = errors.New("Part not found")
+)
+
+const (
+	dispositionAttachment = "attachment"
+	contentTypeText       = "text/"
+	contentTypeTextHTML   = "text/html"
+)
+
+// fileExts are the preferred file extensions of common content types, which
+// have several registered
+var fileExts = map[string]string{
+	contentTypeTextPlain:     ".txt",
+	contentTypeTextHTML:      ".html",
+	contentTypeMessageRFC822: ".eml",
+}
+
+// Extract reads a message from r and writes the decoded content of the part
+// at opts.Path to w, or otherwise writes each attachment, and text part if
+// opts.Text is set, to files in opts.Dir, listing them to w
+func Extract(r io.Reader, w io.Writer, opts ExtractOpts) error {
+	if opts.Path == "" && opts.Dir == "" {
+		return fmt.Errorf("%w: no part path or output dir", ErrInvalidArgs)
+	}
+	m, err := message.Read(transform.NewReader(r, transformer.CRLF{}))
+	if err != nil && !message.IsUnknownCharset(err) && !message.IsUnknownEncoding(err) {
+		return fmt.Errorf("Failed reading mail message: %w", err)
+	}
+	if opts.Path != "" {
+		return extractPath(m, w, opts.Path)
+	}
+	if err := os.MkdirAll(opts.Dir, 0o777); err != nil {
+		return fmt.Errorf("Failed to create dir %s: %w", opts.Dir, err)
+	}
+	return Walk(m, func(path string, e *message.Entity, _ error) (bool, error) {
+		t, params, _ := e.Header.ContentType()
+		if t == "" {
+			t = contentTypeTextPlain
+		}
+		if strings.HasPrefix(t, contentTypeMultipart) {
+			return true, nil
+		}
+		disp, dispParams, _ := e.Header.ContentDisposition()
+		name := dispParams[paramFilename]
+		if name == "" {
+			name = params[paramName]
+		}
+		isAttachment := disp == dispositionAttachment || name != ""
+		if t == contentTypeMessageRFC822 && !isAttachment {
+			return true, nil
+		}
+		if !isAttachment && (!opts.Text || !strings.HasPrefix(t, contentTypeText)) {
+			return false, nil
+		}
+		p, err := writePartFile(opts.Dir, safeFilename(name, path, t), e.Body)
+		if err != nil {
+			return false, err
+		}
+		if _, err := fmt.Fprintf(w, "%s\t%s\n", path, p); err != nil {
+			return false, fmt.Errorf("Failed writing output: %w", err)
+		}
+		return false, nil
+	})
+}
+
+func extractPath(m *message.Entity, w io.Writer, target string) error {
+	found := false
+	if err := Walk(m, func(path string, e *message.Entity, _ error) (bool, error) {
+		if path != target {
+			// only descend into ancestors of the target
+			return path == "" || strings.HasPrefix(target, path+"."), nil
+		}
+		found = true
+		if _, err := io.Copy(w, e.Body); err != nil {
+			return false, fmt.Errorf("Failed writing part %s: %w", path, err)
+		}
+		return false, ErrStopWalk
+	}); err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("%w: %s", ErrPartNotFound, target)
+	}
+	return nil
+}
+
+// safeFilename returns the base name of a filename without path separators
+// or control characters, or a name derived from the part path and content
+// type if there is none
+func safeFilename(name, path, t string) string {
+	name = strings.ReplaceAll(name, `\`, "/")
+	name = filepath.Base(strings.TrimSpace(name))
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || r == '/' || r == filepath.Separator {
+			return -1
+		}
+		return r
+	}, name)
+	name = strings.TrimLeft(name, ".")
+	if name != "" {
+		return name
+	}
+	p := path
+	if p == "" {
+		p = "0"
+	}
+	ext, ok := fileExts[t]
+	if !ok {
+		if exts, err := mime.ExtensionsByType(t); err == nil && len(exts) > 0 {
+			ext = exts[0]
+		}
+	}
+	return "part-" + p + ext
+}
+
+// writePartFile writes r to a new file named name in dir, adding a numeric
+// suffix to the name if it already exists
+func writePartFile(dir, name string, r io.Reader) (_ string, retErr error) {
+	ext := filepath.Ext(name)
+	stem := strings.TrimSuffix(name, ext)
+	var f *os.File
+	for n := 1; ; n++ {
+		p := filepath.Join(dir, name)
+		if n > 1 {
+			p = filepath.Join(dir, fmt.Sprintf("%s-%d%s", stem, n, ext))
+		}
+		var err error
+		f, err = os.OpenFile(p, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o666)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return "", fmt.Errorf("Failed to create file %s: %w", p, err)
+		}
+	}
+	defer func() {
+		if err := f.Close(); err != nil {
+			retErr = errors.Join(retErr, fmt.Errorf("Failed closing file %s: %w", f.Name(), err))
+		}
+	}()
+	if _, err := io.Copy(f, r); err != nil {
+		return "", fmt.Errorf("Failed writing file %s: %w", f.Name(), err)
+	}
+	return f.Name(), nil
+}
@@ -0,0 +1,388 @@
+package inspect
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/emersion/go-message"
+	_ "github.com/emersion/go-message/charset"
+	"golang.org/x/text/transform"
+	"xorkevin.dev/mailcat/transformer"
+)
+
+type (
+	Opts struct {
+		JSON bool
+		// Decode writes the message with its transfer encodings decoded
+		// instead of its structure
+		Decode bool
+	}
+
+	// Report is the structure of a message
+	Report struct {
+		Headers  []Header  `json:"headers"`
+		Root     *Part     `json:"root"`
+		Warnings []Warning `json:"warnings,omitempty"`
+	}
+
+	// Header is a header field with its RFC 2047 encoded words decoded
+	Header struct {
+		Key   string `json:"key"`
+		Value string `json:"value"`
+		Raw   string `json:"raw,omitempty"`
+	}
+
+	// Part is a node of the MIME tree of a message. Parts are numbered by
+	// path as in IMAP, where the children of a multipart or message/rfc822
+	// part n are n.1, n.2, and so on.
+	Part struct {
+		Path        string            `json:"path"`
+		ContentType string            `json:"content_type"`
+		Params      map[string]string `json:"params,omitempty"`
+		Charset     string            `json:"charset,omitempty"`
+		Encoding    string            `json:"encoding,omitempty"`
+		Disposition string            `json:"disposition,omitempty"`
+		Filename    string            `json:"filename,omitempty"`
+		Size        int64             `json:"size"`
+		Headers     []Header          `json:"headers,omitempty"`
+		Message     []Header          `json:"message_headers,omitempty"`
+		Parts       []*Part           `json:"parts,omitempty"`
+	}
+
+	// Warning is a structural problem of a part
+	Warning struct {
+		Path    string `json:"path"`
+		Message string `json:"message"`
+	}
+
+	inspector struct {
+		warnings []Warning
+	}
+)
+
+const (
+	headerMIMEVersion             = "Mime-Version"
+	headerContentType             = "Content-Type"
+	headerContentTransferEncoding = "Content-Transfer-Encoding"
+)
+
+const (
+	contentTypeTextPlain     = "text/plain"
+	contentTypeMessageRFC822 = "message/rfc822"
+	contentTypeMultipart     = "multipart/"
+
+	paramCharset  = "charset"
+	paramBoundary = "boundary"
+	paramName     = "name"
+	paramFilename = "filename"
+)
+
+const (
+	// maxDepth is the maximum nesting of parts
+	maxDepth = 64
+)
+
+// Inspect reads a message from r and writes its headers, MIME tree, and
+// warnings to w
+func Inspect(r io.Reader, w io.Writer, opts Opts) error {
+	if opts.Decode {
+		return Decode(r, w)
+	}
+	report, err := Read(r)
+	if err != nil {
+		return err
+	}
+	if opts.JSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.SetEscapeHTML(false)
+		if err := enc.Encode(report); err != nil {
+			return fmt.Errorf("Failed writing report: %w", err)
+		}
+		return nil
+	}
+	if err := report.WriteReport(w); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Read reads a message from r and returns its structure
+func Read(r io.Reader) (*Report, error) {
+	m, err := message.Read(transform.NewReader(r, transformer.CRLF{}))
+	if err != nil && !message.IsUnknownCharset(err) && !message.IsUnknownEncoding(err) {
+		return nil, fmt.Errorf("Failed reading mail message: %w", err)
+	}
+	i := &inspector{}
+	if err != nil {
+		i.warn("", err.Error())
+	}
+	report := &Report{
+		Headers: i.headers("", m.Header),
+	}
+	if !m.Header.Has(headerMIMEVersion) && m.Header.Has(headerContentType) {
+		i.warn("", "Content-Type without MIME-Version")
+	}
+	report.Root = i.tree(m)
+	report.Warnings = i.warnings
+	return report, nil
+}
+
+func (i *inspector) warn(path string, msg string) {
+	i.warnings = append(i.warnings, Warning{
+		Path:    path,
+		Message: msg,
+	})
+}
+
+// rootPath returns the path of the top level entity of a message, which is
+// unnumbered if multipart, and otherwise is its only part 1
+func rootPath(m *message.Entity) string {
+	if t, _, err := m.Header.ContentType(); err == nil && strings.HasPrefix(t, contentTypeMultipart) {
+		return ""
+	}
+	return "1"
+}
+
+func childPath(parent string, n int) string {
+	if parent == "" {
+		return strconv.Itoa(n)
+	}
+	return parent + "." + strconv.Itoa(n)
+}
+
+func (i *inspector) headers(path string, h message.Header) []Header {
+	var res []Header
+	fields := h.Fields()
+	for fields.Next() {
+		raw := fields.Value()
+		if !isASCII(raw) {
+			i.warn(path, fmt.Sprintf("Unencoded 8-bit data in header %s", fields.Key()))
+		}
+		v, err := fields.Text()
+		if err != nil {
+			i.warn(path, fmt.Sprintf("Failed decoding header %s: %v", fields.Key(), err))
+			v = raw
+		}
+		hdr := Header{
+			Key:   fields.Key(),
+			Value: v,
+		}
+		if v != raw {
+			hdr.Raw = raw
+		}
+		res = append(res, hdr)
+	}
+	return res
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+// tree walks the parts of a message into a tree, warning on structural
+// problems instead of stopping
+func (i *inspector) tree(m *message.Entity) *Part {
+	var root *Part
+	parts := map[string]*Part{}
+	// multiparts are the parts descended into as multiparts, which are checked
+	// for children once walked
+	var multiparts []*Part
+	// attached is the single part of the most recent attached message, whose
+	// headers are those of the message
+	var attached *message.Entity
+	w := &walker{
+		fn: func(path string, e *message.Entity, _ *bytes.Buffer, err error) (bool, error) {
+			if err != nil {
+				i.warn(path, err.Error())
+			}
+			p, params := i.part(path, e)
+			if root == nil {
+				root = p
+			} else {
+				parent := parts[parentPath(path)]
+				parent.Parts = append(parent.Parts, p)
+				if e != attached {
+					p.Headers = i.headers(path, e.Header)
+				}
+			}
+			parts[path] = p
+			if strings.HasPrefix(p.ContentType, contentTypeMultipart) {
+				if !i.multipart(p, e, params) {
+					return false, nil
+				}
+				multiparts = append(multiparts, p)
+				return true, nil
+			}
+			if p.ContentType == contentTypeMessageRFC822 {
+				return true, nil
+			}
+			p.Size = i.size(path, e.Body)
+			if e == attached {
+				// an attached message is the size of its single part
+				parts[parentPath(path)].Size = p.Size
+			}
+			return false, nil
+		},
+		message: func(path string, m *message.Entity) bool {
+			p := parts[path]
+			p.Message = i.headers(path, m.Header)
+			// the parts of an attached multipart message are children of the
+			// message/rfc822 part
+			if t, params, err := m.Header.ContentType(); err == nil && strings.HasPrefix(t, contentTypeMultipart) {
+				if !i.multipart(p, m, params) {
+					return false
+				}
+				multiparts = append(multiparts, p)
+				return true
+			}
+			attached = m
+			return true
+		},
+		warn: func(path string, err error) {
+			i.warn(path, err.Error())
+		},
+	}
+	// errors are given to warn, and the visit functions return none
+	_ = w.walk(m, nil, nil)
+	for _, p := range multiparts {
+		if len(p.Parts) == 0 {
+			i.warn(p.Path, "Multipart without parts")
+		}
+	}
+	return root
+}
+
+func parentPath(path string) string {
+	if n := strings.LastIndex(path, "."); n >= 0 {
+		return path[:n]
+	}
+	return ""
+}
+
+// part returns a part without its children, and its content type params
+func (i *inspector) part(path string, e *message.Entity) (*Part, map[string]string) {
+	p := &Part{
+		Path: path,
+	}
+	t, params, err := e.Header.ContentType()
+	if err != nil {
+		i.warn(path, fmt.Sprintf("Invalid Content-Type: %v", err))
+		t = ""
+		params = nil
+	}
+	if t == "" {
+		t = contentTypeTextPlain
+	}
+	p.ContentType = t
+	if len(params) > 0 {
+		p.Params = params
+	}
+	if c, ok := params[paramCharset]; ok {
+		p.Charset = c
+		delete(params, paramCharset)
+	}
+	p.Encoding = strings.ToLower(strings.TrimSpace(e.Header.Get(headerContentTransferEncoding)))
+	if disp, dispParams, err := e.Header.ContentDisposition(); err != nil {
+		if e.Header.Has("Content-Disposition") {
+			i.warn(path, fmt.Sprintf("Invalid Content-Disposition: %v", err))
+		}
+	} else {
+		p.Disposition = disp
+		p.Filename = dispParams[paramFilename]
+	}
+	if p.Filename == "" {
+		p.Filename = params[paramName]
+	}
+	if len(p.Params) == 0 {
+		p.Params = nil
+	}
+	return p, params
+}
+
+// multipart checks a multipart entity of the part p, and returns whether its
+// children may be read
+func (i *inspector) multipart(p *Part, e *message.Entity, params map[string]string) bool {
+	switch enc := strings.ToLower(strings.TrimSpace(e.Header.Get(headerContentTransferEncoding))); enc {
+	case "", "7bit", "8bit", "binary":
+	default:
+		i.warn(p.Path, fmt.Sprintf("Multipart with Content-Transfer-Encoding %s", enc))
+	}
+	if params[paramBoundary] == "" {
+		i.warn(p.Path, "Multipart without boundary")
+		p.Size = i.size(p.Path, e.Body)
+		return false
+	}
+	return true
+}
+
+func (i *inspector) size(path string, r io.Reader) int64 {
+	n, err := io.Copy(io.Discard, r)
+	if err != nil {
+		i.warn(path, fmt.Sprintf("Failed decoding body: %v", err))
+	}
+	return n
+}
+
+// WriteReport writes a human readable report
+func (r *Report) WriteReport(w io.Writer) error {
+	var b strings.Builder
+	b.WriteString("Headers:\n")
+	for _, i := range r.Headers {
+		fmt.Fprintf(&b, "  %s: %s\n", i.Key, i.Value)
+	}
+	b.WriteString("\nStructure:\n")
+	writePart(&b, r.Root, 1)
+	if len(r.Warnings) > 0 {
+		b.WriteString("\nWarnings:\n")
+		for _, i := range r.Warnings {
+			path := i.Path
+			if path == "" {
+				path = "message"
+			}
+			fmt.Fprintf(&b, "  %s: %s\n", path, i.Message)
+		}
+	}
+	if _, err := io.WriteString(w, b.String()); err != nil {
+		return fmt.Errorf("Failed writing report: %w", err)
+	}
+	return nil
+}
+
+func writePart(b *strings.Builder, p *Part, depth int) {
+	b.WriteString(strings.Repeat("  ", depth))
+	if p.Path != "" {
+		b.WriteString(p.Path)
+		b.WriteString(" ")
+	}
+	b.WriteString(p.ContentType)
+	if p.Charset != "" {
+		fmt.Fprintf(b, " charset=%s", p.Charset)
+	}
+	if p.Encoding != "" {
+		fmt.Fprintf(b, " encoding=%s", p.Encoding)
+	}
+	if p.Disposition != "" {
+		fmt.Fprintf(b, " disposition=%s", p.Disposition)
+	}
+	if p.Filename != "" {
+		fmt.Fprintf(b, " filename=%q", p.Filename)
+	}
+	if len(p.Parts) == 0 {
+		fmt.Fprintf(b, " size=%d", p.Size)
+	}
+	b.WriteString("\n")
+	for _, i := range p.Parts {
+		writePart(b, i, depth+1)
+	}
+}
@@ -0,0 +1,562 @@
+package inspect
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Read(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		Name     string
+		Inp      string
+		Paths    []string
+		Warnings []Warning
+	}{
+		{
+			Name: "Nested multipart and attached message",
+			Inp: `MIME-Version: 1.0
+Subject: =?utf-8?q?caf=C3=A9?=
+Content-Type: multipart/mixed; boundary=a
+
+--a
+Content-Type: multipart/alternative; boundary=b
+
+--b
+Content-Type: text/plain; charset=utf-8
+
+hi
+--b
+Content-Type: text/html; charset=utf-8
+
+<p>hi</p>
+--b--
+--a
+Content-Type: message/rfc822
+
+Subject: attached
+Content-Type: multipart/mixed; boundary=c
+
+--c
+Content-Type: text/plain
+
+attached
+--c--
+--a
+Content-Type: application/octet-stream
+Content-Transfer-Encoding: base64
+Content-Disposition: attachment; filename="a.bin"
+
+AAEC
+--a--
+`,
+			Paths: []string{"", "1", "1.1", "1.2", "2", "2.1", "3"},
+		},
+		{
+			Name: "Single part",
+			Inp: `Subject: plain
+
+hi
+`,
+			Paths: []string{"1"},
+		},
+		{
+			Name: "Structural problems",
+			Inp: `Subject: bad
+Content-Type: multipart/mixed; boundary=a
+
+--a
+Content-Type: multipart/alternative
+
+hi
+--a--
+`,
+			Paths: []string{"", "1"},
+			Warnings: []Warning{
+				{Path: "", Message: "Content-Type without MIME-Version"},
+				{Path: "1", Message: "Multipart without boundary"},
+			},
+		},
+		{
+			Name: "Attached messages and unreadable multipart",
+			Inp: `MIME-Version: 1.0
+Subject: bad
+Content-Type: multipart/mixed; boundary=a
+
+--a
+Content-Type: message/rfc822
+
+Subject: single
+Content-Type: text/plain; charset=bogus
+
+hi
+--a
+Content-Type: multipart/mixed; boundary=z
+
+no parts
+--a
+Content-Type: message/rfc822
+
+Subject: multi
+Content-Type: multipart/alternative; boundary=c
+
+--c
+Content-Type: text/plain
+
+x
+--c--
+--a--
+`,
+			Paths: []string{"", "1", "1.1", "2", "3", "3.1"},
+			Warnings: []Warning{
+				{Path: "1.1", Message: "unknown charset: unknown charset: charset \"bogus\": htmlindex: invalid encoding name"},
+				{Path: "2", Message: "Failed reading multipart: multipart: NextPart: EOF"},
+				{Path: "2", Message: "Multipart without parts"},
+			},
+		},
+	} {
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			assert := require.New(t)
+
+			report, err := Read(strings.NewReader(tc.Inp))
+			assert.NoError(err)
+			var paths []string
+			var walk func(p *Part)
+			walk = func(p *Part) {
+				paths = append(paths, p.Path)
+				for _, i := range p.Parts {
+					walk(i)
+				}
+			}
+			walk(report.Root)
+			assert.Equal(tc.Paths, paths)
+			assert.Equal(tc.Warnings, report.Warnings)
+		})
+	}
+}
+
+func Test_Diff(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		Name  string
+		A     string
+		B     string
+		Opts  DiffOpts
+		Out   string
+		Equal bool
+	}{
+		{
+			Name: "Semantically equal",
+			A: `From: Bob <bob@example.com>
+To: a@example.com, b@example.com
+Date: Mon, 02 Jan 2006 15:04:05 -0700
+Subject: =?utf-8?q?caf=C3=A9?=
+Content-Type: text/plain; charset=utf-8
+Content-Transfer-Encoding: quoted-printable
+
+caf=C3=A9
+`,
+			B: `From: Bob <BOB@example.com>
+To: b@example.com,
+ a@example.com
+Date: Mon, 2 Jan 2006 22:04:05 +0000
+Subject: café
+Content-Type: text/plain; charset=UTF-8
+Content-Transfer-Encoding: base64
+
+Y2Fmw6kK
+`,
+			Equal: true,
+		},
+		{
+			Name: "Volatile headers",
+			A: `Message-ID: <a@example.com>
+Subject: hi
+Content-Type: multipart/mixed; boundary=a
+
+--a
+Content-Type: text/html
+
+<img src="cid:x@example.com">
+--a
+Content-Type: image/png
+Content-ID: <x@example.com>
+
+png
+--a--
+`,
+			B: `Message-ID: <b@example.com>
+Subject: hi
+Content-Type: multipart/mixed; boundary=b
+
+--b
+Content-Type: text/html
+
+<img src="cid:y@example.com">
+--b
+Content-Type: image/png
+Content-ID: <y@example.com>
+
+png
+--b--
+`,
+			Opts:  DiffOpts{IgnoreVolatile: true},
+			Equal: true,
+		},
+		{
+			Name: "Differences",
+			A: `Subject: hi
+X-Tag: a
+
+one
+two
+`,
+			B: `Subject: hello
+X-Tag: b
+
+one
+three
+`,
+			Opts: DiffOpts{Ignore: []string{"x-*"}},
+			Out: `header Subject:
+- hi
++ hello
+part 1 text/plain content:
+  one
+- two
++ three
+`,
+		},
+	} {
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			assert := require.New(t)
+
+			var b strings.Builder
+			err := Diff(strings.NewReader(tc.A), strings.NewReader(tc.B), &b, tc.Opts)
+			if tc.Equal {
+				assert.NoError(err)
+			} else {
+				assert.ErrorIs(err, ErrDiff)
+			}
+			assert.Equal(tc.Out, b.String())
+		})
+	}
+}
+
+func Test_Decode(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		Name string
+		Inp  string
+		Out  string
+	}{
+		{
+			Name: "Encoded parts",
+			Inp: `Subject: hi
+Content-Type: multipart/mixed; boundary=a
+
+--a
+Content-Type: text/plain; charset=utf-8
+Content-Transfer-Encoding: quoted-printable
+
+caf=C3=A9
+--a
+Content-Type: text/plain
+Content-Transfer-Encoding: base64
+
+aGkK
+--a
+Content-Type: text/plain
+
+unchanged
+--a--
+`,
+			Out: "Subject: hi\r\nContent-Type: multipart/mixed; boundary=a\r\n\r\n" +
+				"--a\r\nContent-Transfer-Encoding: 8bit\r\nContent-Type: text/plain; charset=utf-8\r\n\r\ncafé\r\n" +
+				"--a\r\nContent-Transfer-Encoding: 7bit\r\nContent-Type: text/plain\r\n\r\nhi\n\r\n" +
+				"--a\r\nContent-Type: text/plain\r\n\r\nunchanged\r\n--a--\r\n",
+		},
+	} {
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			assert := require.New(t)
+
+			var b strings.Builder
+			assert.NoError(Decode(strings.NewReader(tc.Inp), &b))
+			assert.Equal(tc.Out, b.String())
+		})
+	}
+}
+
+func Test_SafeFilename(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		Name     string
+		Filename string
+		Path     string
+		Type     string
+		Exp      string
+	}{
+		{
+			Name:     "Plain name",
+			Filename: "notes.txt",
+			Path:     "2",
+			Type:     "text/plain",
+			Exp:      "notes.txt",
+		},
+		{
+			Name:     "Parent traversal",
+			Filename: "../../etc/passwd",
+			Path:     "2",
+			Type:     "text/plain",
+			Exp:      "passwd",
+		},
+		{
+			Name:     "Absolute path",
+			Filename: "/etc/passwd",
+			Path:     "2",
+			Type:     "text/plain",
+			Exp:      "passwd",
+		},
+		{
+			Name:     "Windows path",
+			Filename: `..\..\windows\system.ini`,
+			Path:     "2",
+			Type:     "text/plain",
+			Exp:      "system.ini",
+		},
+		{
+			Name:     "Hidden file and control characters",
+			Filename: "..\x00.bash\nrc",
+			Path:     "2",
+			Type:     "text/plain",
+			Exp:      "bashrc",
+		},
+		{
+			Name:     "Only a parent directory",
+			Filename: "..",
+			Path:     "1.2",
+			Type:     "text/html",
+			Exp:      "part-1.2.html",
+		},
+		{
+			Name: "No name for the top level part",
+			Path: "",
+			Type: "message/rfc822",
+			Exp:  "part-0.eml",
+		},
+	} {
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			assert := require.New(t)
+
+			assert.Equal(tc.Exp, safeFilename(tc.Filename, tc.Path, tc.Type))
+		})
+	}
+}
+
+const testExtractInp = `MIME-Version: 1.0
+Subject: hi
+Content-Type: multipart/mixed; boundary=a
+
+--a
+Content-Type: multipart/alternative; boundary=b
+
+--b
+Content-Type: text/plain; charset=utf-8
+Content-Transfer-Encoding: quoted-printable
+
+caf=C3=A9
+--b
+Content-Type: text/html; charset=utf-8
+
+<p>hi</p>
+--b--
+--a
+Content-Type: text/plain
+Content-Disposition: attachment; filename="../../notes.txt"
+Content-Transfer-Encoding: base64
+
+aGVsbG8K
+--a
+Content-Type: application/octet-stream
+Content-Disposition: attachment; filename="notes.txt"
+
+again
+--a--
+`
+
+func Test_Extract(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		Name  string
+		Text  bool
+		Files map[string]string
+		Out   []string
+	}{
+		{
+			Name: "Attachments",
+			Files: map[string]string{
+				"notes.txt":   "hello\n",
+				"notes-2.txt": "again",
+			},
+			Out: []string{"2\tnotes.txt", "3\tnotes-2.txt"},
+		},
+		{
+			Name: "Attachments and text parts",
+			Text: true,
+			Files: map[string]string{
+				"part-1.1.txt":  "café",
+				"part-1.2.html": "<p>hi</p>",
+				"notes.txt":     "hello\n",
+				"notes-2.txt":   "again",
+			},
+			Out: []string{"1.1\tpart-1.1.txt", "1.2\tpart-1.2.html", "2\tnotes.txt", "3\tnotes-2.txt"},
+		},
+	} {
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			assert := require.New(t)
+
+			dir := filepath.Join(t.TempDir(), "out")
+			var b strings.Builder
+			assert.NoError(Extract(strings.NewReader(testExtractInp), &b, ExtractOpts{
+				Dir:  dir,
+				Text: tc.Text,
+			}))
+			var out []string
+			for _, i := range tc.Out {
+				path, name, _ := strings.Cut(i, "\t")
+				out = append(out, path+"\t"+filepath.Join(dir, name))
+			}
+			assert.Equal(strings.Join(out, "\n")+"\n", b.String())
+			entries, err := os.ReadDir(dir)
+			assert.NoError(err)
+			assert.Len(entries, len(tc.Files))
+			for k, v := range tc.Files {
+				content, err := os.ReadFile(filepath.Join(dir, k))
+				assert.NoError(err)
+				assert.Equal(v, strings.ReplaceAll(string(content), "\r\n", "\n"))
+			}
+		})
+	}
+}
+
+func Test_ExtractPath(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		Name string
+		Path string
+		Out  string
+		Err  error
+	}{
+		{
+			Name: "Nested part",
+			Path: "1.1",
+			Out:  "café",
+		},
+		{
+			Name: "Decoded attachment",
+			Path: "2",
+			Out:  "hello\n",
+		},
+		{
+			Name: "Missing part",
+			Path: "1.3",
+			Err:  ErrPartNotFound,
+		},
+	} {
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			assert := require.New(t)
+
+			var b strings.Builder
+			err := Extract(strings.NewReader(testExtractInp), &b, ExtractOpts{
+				Path: tc.Path,
+			})
+			if tc.Err != nil {
+				assert.ErrorIs(err, tc.Err)
+				return
+			}
+			assert.NoError(err)
+			assert.Equal(tc.Out, strings.ReplaceAll(b.String(), "\r\n", "\n"))
+		})
+	}
+}
+
+func Test_ParseMessage(t *testing.T) {
+	t.Parallel()
+
+	assert := require.New(t)
+
+	m, err := ParseMessage(strings.NewReader(`From: Alice <alice@example.com>
+To: bob@example.com, =?utf-8?q?Caf=C3=A9?= <carol@example.com>
+Subject: =?utf-8?q?caf=C3=A9?=
+Message-ID: <m2@example.com>
+In-Reply-To: <m1@example.com>
+References: <m0@example.com> <m1@example.com>
+Date: Mon, 02 Jan 2006 15:04:05 -0700
+MIME-Version: 1.0
+Content-Type: multipart/mixed; boundary=a
+
+--a
+Content-Type: multipart/alternative; boundary=b
+
+--b
+Content-Type: text/plain; charset=utf-8
+Content-Transfer-Encoding: quoted-printable
+
+caf=C3=A9
+--b
+Content-Type: text/html; charset=utf-8
+
+<p>hi</p>
+--b--
+--a
+Content-Type: message/rfc822
+
+Subject: attached
+
+attached body
+--a
+Content-Type: application/pdf; name="menu.pdf"
+Content-Disposition: attachment
+Content-Transfer-Encoding: base64
+
+JVBERg==
+--a--
+`))
+	assert.NoError(err)
+	assert.Equal([]Address{{Name: "Alice", Address: "alice@example.com"}}, m.From)
+	assert.Equal([]Address{{Address: "bob@example.com"}, {Name: "Café", Address: "carol@example.com"}}, m.To)
+	assert.Empty(m.Cc)
+	assert.Equal("café", m.Subject)
+	assert.Equal("m2@example.com", m.MessageID)
+	assert.Equal([]string{"m1@example.com"}, m.InReplyTo)
+	assert.Equal([]string{"m0@example.com", "m1@example.com"}, m.References)
+	assert.Equal("2006-01-02T15:04:05-07:00", m.Date)
+	// the bodies are of the message and not of the attached message
+	assert.Equal("café", m.Text)
+	assert.Equal("<p>hi</p>", m.HTML)
+	assert.Equal([]Leaf{
+		{Path: "1.1", ContentType: "text/plain", Charset: "utf-8", Size: 5, Text: "café"},
+		{Path: "1.2", ContentType: "text/html", Charset: "utf-8", Size: 9, Text: "<p>hi</p>"},
+		{Path: "2.1", ContentType: "text/plain", Size: 13, Text: "attached body"},
+		{Path: "3", ContentType: "application/pdf", Disposition: "attachment", Filename: "menu.pdf", Size: 4},
+	}, m.Parts)
+
+	_, err = ParseMessage(strings.NewReader("From: not an address\n\nhi\n"))
+	assert.ErrorContains(err, "Invalid From")
+}
@@ -0,0 +1,208 @@
+package inspect
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-message"
+	emmail "github.com/emersion/go-message/mail"
+	"golang.org/x/text/transform"
+	"xorkevin.dev/mailcat/transformer"
+)
+
+type (
+	// Message is a parsed message
+	Message struct {
+		From       []Address `json:"from"`
+		Sender     []Address `json:"sender,omitempty"`
+		ReplyTo    []Address `json:"reply_to,omitempty"`
+		To         []Address `json:"to"`
+		Cc         []Address `json:"cc,omitempty"`
+		Bcc        []Address `json:"bcc,omitempty"`
+		Subject    string    `json:"subject"`
+		MessageID  string    `json:"message_id,omitempty"`
+		InReplyTo  []string  `json:"in_reply_to,omitempty"`
+		References []string  `json:"references,omitempty"`
+		Date       string    `json:"date,omitempty"`
+		Headers    []Header  `json:"headers"`
+		Text       string    `json:"text,omitempty"`
+		HTML       string    `json:"html,omitempty"`
+		Parts      []Leaf    `json:"parts"`
+	}
+
+	// Address is a parsed address
+	Address struct {
+		Name    string `json:"name,omitempty"`
+		Address string `json:"address"`
+	}
+
+	// Leaf is a non-multipart part of a message with its decoded text if it
+	// is a text part
+	Leaf struct {
+		Path        string `json:"path"`
+		ContentType string `json:"content_type"`
+		Charset     string `json:"charset,omitempty"`
+		Disposition string `json:"disposition,omitempty"`
+		Filename    string `json:"filename,omitempty"`
+		Size        int64  `json:"size"`
+		Text        string `json:"text,omitempty"`
+	}
+)
+
+const (
+	headerSender     = "Sender"
+	headerReplyTo    = "Reply-To"
+	headerFrom       = "From"
+	headerTo         = "To"
+	headerCc         = "Cc"
+	headerBcc        = "Bcc"
+	headerInReplyTo  = "In-Reply-To"
+	headerReferences = "References"
+	headerDate       = "Date"
+)
+
+// Parse reads a message from r and writes it as JSON to w
+func Parse(r io.Reader, w io.Writer) error {
+	m, err := ParseMessage(r)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(m); err != nil {
+		return fmt.Errorf("Failed writing json: %w", err)
+	}
+	return nil
+}
+
+func parseAddrs(h *emmail.Header, key string) ([]Address, error) {
+	addrs, err := h.AddressList(key)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid %s: %w", key, err)
+	}
+	res := make([]Address, 0, len(addrs))
+	for _, i := range addrs {
+		res = append(res, Address{
+			Name:    i.Name,
+			Address: i.Address,
+		})
+	}
+	return res, nil
+}
+
+// ParseMessage reads and parses a message from r
+func ParseMessage(r io.Reader) (*Message, error) {
+	e, err := message.Read(transform.NewReader(r, transformer.CRLF{}))
+	if err != nil && !message.IsUnknownCharset(err) && !message.IsUnknownEncoding(err) {
+		return nil, fmt.Errorf("Failed reading mail message: %w", err)
+	}
+	h := emmail.Header{
+		Header: e.Header,
+	}
+	i := &inspector{}
+	m := &Message{
+		Headers: i.headers("", e.Header),
+		Parts:   []Leaf{},
+	}
+	for _, j := range []struct {
+		key   string
+		addrs *[]Address
+	}{
+		{key: headerFrom, addrs: &m.From},
+		{key: headerSender, addrs: &m.Sender},
+		{key: headerReplyTo, addrs: &m.ReplyTo},
+		{key: headerTo, addrs: &m.To},
+		{key: headerCc, addrs: &m.Cc},
+		{key: headerBcc, addrs: &m.Bcc},
+	} {
+		addrs, err := parseAddrs(&h, j.key)
+		if err != nil {
+			return nil, err
+		}
+		*j.addrs = addrs
+	}
+	if m.Subject, err = h.Subject(); err != nil {
+		return nil, fmt.Errorf("Invalid Subject: %w", err)
+	}
+	if m.MessageID, err = h.MessageID(); err != nil {
+		return nil, fmt.Errorf("Invalid Message-ID: %w", err)
+	}
+	if m.InReplyTo, err = h.MsgIDList(headerInReplyTo); err != nil {
+		return nil, fmt.Errorf("Invalid In-Reply-To: %w", err)
+	}
+	if m.References, err = h.MsgIDList(headerReferences); err != nil {
+		return nil, fmt.Errorf("Invalid References: %w", err)
+	}
+	if h.Has(headerDate) {
+		t, err := h.Date()
+		if err != nil {
+			return nil, fmt.Errorf("Invalid Date: %w", err)
+		}
+		m.Date = t.Format(time.RFC3339)
+	}
+	var hasText, hasHTML bool
+	// attached are the paths of attached messages, whose parts are not bodies
+	// of the message
+	var attached []string
+	if err := Walk(e, func(path string, p *message.Entity, _ error) (bool, error) {
+		t, params, _ := p.Header.ContentType()
+		if t == "" {
+			t = contentTypeTextPlain
+		}
+		if strings.HasPrefix(t, contentTypeMultipart) {
+			return true, nil
+		}
+		if t == contentTypeMessageRFC822 {
+			// attached messages are included as their parts
+			attached = append(attached, path)
+			return true, nil
+		}
+		leaf := Leaf{
+			Path:        path,
+			ContentType: t,
+			Charset:     params[paramCharset],
+		}
+		disp, dispParams, _ := p.Header.ContentDisposition()
+		leaf.Disposition = disp
+		leaf.Filename = dispParams[paramFilename]
+		if leaf.Filename == "" {
+			leaf.Filename = params[paramName]
+		}
+		if strings.HasPrefix(t, contentTypeText) {
+			b, err := io.ReadAll(p.Body)
+			if err != nil {
+				return false, fmt.Errorf("Failed reading part %s: %w", path, err)
+			}
+			leaf.Size = int64(len(b))
+			// line endings are normalized to LF for ease of comparison
+			leaf.Text = strings.ReplaceAll(string(b), "\r\n", "\n")
+			isBody := disp != dispositionAttachment
+			for _, j := range attached {
+				if strings.HasPrefix(path, j+".") {
+					isBody = false
+					break
+				}
+			}
+			if isBody {
+				if t == contentTypeTextPlain && !hasText {
+					m.Text = leaf.Text
+					hasText = true
+				} else if t == contentTypeTextHTML && !hasHTML {
+					m.HTML = leaf.Text
+					hasHTML = true
+				}
+			}
+		} else {
+			leaf.Size = i.size(path, p.Body)
+		}
+		m.Parts = append(m.Parts, leaf)
+		return false, nil
+	}); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
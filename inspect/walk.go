@@ -0,0 +1,184 @@
+package inspect
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/emersion/go-message"
+	"github.com/emersion/go-message/textproto"
+)
+
+// ErrStopWalk may be returned by a VisitFunc to stop walking without error
+var ErrStopWalk = errors.New("Stop walk")
+
+type (
+	// VisitFunc is called for each part in pre-order with any error reading
+	// the part that still allows it to be read, such as an unknown charset,
+	// and returns whether to descend into its children. The part body may be
+	// consumed only if it is not descended into.
+	VisitFunc func(path string, e *message.Entity, err error) (bool, error)
+
+	// RawVisitFunc is a VisitFunc that is also given the raw body of a part
+	// before its transfer and charset decoding. The raw body holds what has
+	// been read of the part body so far, and is nil for multipart and
+	// message/rfc822 parts.
+	RawVisitFunc func(path string, e *message.Entity, raw *bytes.Buffer, err error) (bool, error)
+
+	// PartError is an error reading the children of the part at Path
+	PartError struct {
+		Path string
+		Err  error
+	}
+
+	walker struct {
+		fn  RawVisitFunc
+		raw bool
+		// message, if set, is called with each attached message before its
+		// parts are walked, and returns whether to walk them
+		message func(path string, m *message.Entity) bool
+		// warn, if set, is given errors reading the children of a part, after
+		// which the walk continues with the siblings of the part
+		warn func(path string, err error)
+	}
+)
+
+var errNestedTooDeep = errors.New("Parts nested too deeply")
+
+func (e *PartError) Error() string {
+	if e.Path == "" {
+		return e.Err.Error()
+	}
+	return fmt.Sprintf("Part %s: %v", e.Path, e.Err)
+}
+
+func (e *PartError) Unwrap() error {
+	return e.Err
+}
+
+// Walk visits the parts of a message, numbered by path as in IMAP
+func Walk(m *message.Entity, fn VisitFunc) error {
+	w := &walker{
+		fn: func(path string, e *message.Entity, _ *bytes.Buffer, err error) (bool, error) {
+			return fn(path, e, err)
+		},
+	}
+	return w.walk(m, nil, nil)
+}
+
+// WalkRaw reads a message from r and visits its parts as Walk, also giving
+// each part its raw body. Any error reading the top level part that still
+// allows it to be read is given to fn.
+func WalkRaw(r io.Reader, fn RawVisitFunc) error {
+	w := &walker{
+		fn:  fn,
+		raw: true,
+	}
+	m, raw, partErr := w.read(r)
+	if m == nil {
+		return fmt.Errorf("Failed reading mail message: %w", partErr)
+	}
+	return w.walk(m, raw, partErr)
+}
+
+func (w *walker) walk(m *message.Entity, raw *bytes.Buffer, partErr error) error {
+	if err := w.walkPart(m, raw, rootPath(m), 0, partErr); err != nil && !errors.Is(err, ErrStopWalk) {
+		return err
+	}
+	return nil
+}
+
+// read reads a message, returning a nil entity if it cannot be read
+func (w *walker) read(r io.Reader) (*message.Entity, *bytes.Buffer, error) {
+	br := bufio.NewReader(r)
+	h, err := textproto.ReadHeader(br)
+	if err != nil {
+		return nil, nil, err
+	}
+	return w.newEntity(h, br)
+}
+
+// newEntity creates an entity, recording its raw body if it is a leaf part
+func (w *walker) newEntity(h textproto.Header, body io.Reader) (*message.Entity, *bytes.Buffer, error) {
+	mh := message.Header{Header: h}
+	var raw *bytes.Buffer
+	if w.raw {
+		if t, _, _ := mh.ContentType(); !strings.HasPrefix(t, contentTypeMultipart) && t != contentTypeMessageRFC822 {
+			raw = &bytes.Buffer{}
+			body = io.TeeReader(body, raw)
+		}
+	}
+	// the only errors of New are an unknown charset or transfer encoding,
+	// which still allow the part to be read
+	e, err := message.New(mh, body)
+	return e, raw, err
+}
+
+func (w *walker) walkPart(e *message.Entity, raw *bytes.Buffer, path string, depth int, partErr error) error {
+	descend, err := w.fn(path, e, raw, partErr)
+	if err != nil {
+		return err
+	}
+	if !descend {
+		return nil
+	}
+	if depth > maxDepth {
+		if w.warn != nil {
+			w.warn(path, errNestedTooDeep)
+		}
+		return nil
+	}
+	t, params, _ := e.Header.ContentType()
+	if strings.HasPrefix(t, contentTypeMultipart) {
+		return w.walkChildren(e.Body, params[paramBoundary], path, depth)
+	}
+	if t == contentTypeMessageRFC822 {
+		m, raw, partErr := w.read(e.Body)
+		if m == nil {
+			return w.fail(path, fmt.Errorf("Failed reading attached message: %w", partErr))
+		}
+		if w.message != nil && !w.message(path, m) {
+			return nil
+		}
+		// the parts of an attached multipart message are numbered as children
+		// of the message/rfc822 part
+		if t, params, _ := m.Header.ContentType(); strings.HasPrefix(t, contentTypeMultipart) {
+			return w.walkChildren(m.Body, params[paramBoundary], path, depth)
+		}
+		return w.walkPart(m, raw, childPath(path, 1), depth+1, partErr)
+	}
+	return nil
+}
+
+func (w *walker) walkChildren(body io.Reader, boundary string, path string, depth int) error {
+	mr := textproto.NewMultipartReader(body, boundary)
+	for n := 1; ; n++ {
+		p, err := mr.NextPart()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return w.fail(path, fmt.Errorf("Failed reading multipart: %w", err))
+		}
+		child, raw, partErr := w.newEntity(p.Header, p)
+		if err := w.walkPart(child, raw, childPath(path, n), depth+1, partErr); err != nil {
+			return err
+		}
+	}
+}
+
+// fail returns an error reading the children of the part at path, unless it
+// is given to warn
+func (w *walker) fail(path string, err error) error {
+	if w.warn != nil {
+		w.warn(path, err)
+		return nil
+	}
+	return &PartError{
+		Path: path,
+		Err:  err,
+	}
+}
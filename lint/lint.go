@@ -0,0 +1,545 @@
+// Package lint checks mail messages for RFC 5322 and MIME compliance.
+package lint
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/textproto"
+	"net/url"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+	"unicode/utf8"
+
+	"github.com/emersion/go-message"
+	_ "github.com/emersion/go-message/charset"
+	emmail "github.com/emersion/go-message/mail"
+	"xorkevin.dev/mailcat/inspect"
+)
+
+type (
+	// Severity is the severity of a problem
+	Severity string
+
+	Opts struct {
+		JSON bool
+		CRLF bool
+		// Bulk checks the message as bulk mail regardless of its headers
+		Bulk   bool
+		FailOn Severity
+		// Now is the time to check dates against, and defaults to the current
+		// time
+		Now time.Time
+	}
+
+	// Rule is a lint rule
+	Rule struct {
+		ID       string
+		Severity Severity
+		Summary  string
+	}
+
+	// Problem is a violation of a rule
+	Problem struct {
+		Rule     string   `json:"rule"`
+		Severity Severity `json:"severity"`
+		Location string   `json:"location,omitempty"`
+		Message  string   `json:"message"`
+	}
+
+	// Result is the outcome of linting a message
+	Result struct {
+		Problems []Problem `json:"problems"`
+	}
+
+	linter struct {
+		opts     Opts
+		problems []Problem
+	}
+)
+
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+	SeverityInfo    Severity = "info"
+	// SeverityNone is never reached by a problem
+	SeverityNone Severity = "none"
+)
+
+var severityRank = map[Severity]int{
+	SeverityInfo:    1,
+	SeverityWarning: 2,
+	SeverityError:   3,
+	SeverityNone:    4,
+}
+
+var (
+	ErrInvalidArgs = errors.New("Invalid args")
+	ErrLintFailed  = errors.New("Lint failed")
+)
+
+const (
+	RuleLineLength        = "line-length"
+	RuleBareCR            = "bare-cr"
+	RuleBareLF            = "bare-lf"
+	RuleHeaderSyntax      = "header-syntax"
+	RuleHeader8Bit        = "header-8bit"
+	RuleDuplicateHeader   = "duplicate-header"
+	RuleMissingHeader     = "missing-header"
+	RuleInvalidHeader     = "invalid-header"
+	RuleMissingMIME       = "missing-mime-version"
+	RuleContentType       = "invalid-content-type"
+	RuleBoundary          = "invalid-boundary"
+	RuleMultipartEncoding = "multipart-encoding"
+	RuleUnknownCharset    = "unknown-charset"
+	RuleUnknownEncoding   = "unknown-encoding"
+	RuleBodyEncoding      = "invalid-body-encoding"
+	RuleBody8Bit          = "body-8bit"
+	RuleDateFuture        = "date-future"
+	RuleMissingMsgID      = "missing-message-id"
+
+	RuleListUnsubscribe     = "bulk-list-unsubscribe"
+	RuleOneClick            = "bulk-one-click"
+	RuleListID              = "bulk-list-id"
+	RuleInvalidListHeader   = "invalid-list-header"
+	RuleListUnsubscribePost = "list-unsubscribe-post"
+)
+
+// Rules are all lint rules with their severities
+var Rules = []Rule{
+	{RuleLineLength, SeverityError, "lines must be at most 998 octets"},
+	{RuleBareCR, SeverityError, "CR must only occur in CRLF"},
+	{RuleBareLF, SeverityError, "LF must only occur in CRLF, unless all line endings are LF and CRLF is not required"},
+	{RuleHeaderSyntax, SeverityError, "the header block must be parseable"},
+	{RuleHeader8Bit, SeverityWarning, "headers should not contain unencoded 8-bit data"},
+	{RuleDuplicateHeader, SeverityError, "headers limited to a single occurrence must not be repeated"},
+	{RuleMissingHeader, SeverityError, "Date and From headers are required"},
+	{RuleInvalidHeader, SeverityError, "address, date, and message id headers must be valid"},
+	{RuleMissingMIME, SeverityError, "MIME headers require MIME-Version"},
+	{RuleContentType, SeverityError, "Content-Type must be valid"},
+	{RuleBoundary, SeverityError, "multipart boundaries must be valid and delimit parts"},
+	{RuleMultipartEncoding, SeverityError, "multipart parts must be 7bit, 8bit, or binary encoded"},
+	{RuleUnknownCharset, SeverityError, "charsets must be known"},
+	{RuleUnknownEncoding, SeverityError, "transfer encodings must be known"},
+	{RuleBodyEncoding, SeverityError, "bodies must be valid in their transfer encoding"},
+	{RuleBody8Bit, SeverityWarning, "8-bit data should have an 8bit or binary transfer encoding"},
+	{RuleDateFuture, SeverityWarning, "Date should not be in the future"},
+	{RuleMissingMsgID, SeverityWarning, "Message-ID should be present"},
+	{RuleListUnsubscribe, SeverityError, "bulk mail must have List-Unsubscribe"},
+	{RuleOneClick, SeverityError, "bulk mail must support one click unsubscribe with an https List-Unsubscribe url and List-Unsubscribe-Post"},
+	{RuleListID, SeverityInfo, "bulk mail should have List-Id"},
+	{RuleInvalidListHeader, SeverityError, "List-Unsubscribe must be a list of <uri> and List-Id must be <list.namespace>"},
+	{RuleListUnsubscribePost, SeverityError, "List-Unsubscribe-Post must be List-Unsubscribe=One-Click with an https List-Unsubscribe url"},
+}
+
+var ruleSeverity = func() map[string]Severity {
+	m := make(map[string]Severity, len(Rules))
+	for _, i := range Rules {
+		m[i.ID] = i.Severity
+	}
+	return m
+}()
+
+const (
+	maxLineLen = 998
+	// dateSkew is the allowed clock skew of Date
+	dateSkew = 15 * time.Minute
+	// maxBoundaryLen is the maximum boundary length of RFC 2046
+	maxBoundaryLen = 70
+)
+
+const (
+	headerFrom                    = "From"
+	headerSender                  = "Sender"
+	headerReplyTo                 = "Reply-To"
+	headerTo                      = "To"
+	headerCc                      = "Cc"
+	headerBcc                     = "Bcc"
+	headerMsgID                   = "Message-Id"
+	headerInReplyTo               = "In-Reply-To"
+	headerReferences              = "References"
+	headerSubject                 = "Subject"
+	headerDate                    = "Date"
+	headerMIMEVersion             = "Mime-Version"
+	headerContentType             = "Content-Type"
+	headerContentTransferEncoding = "Content-Transfer-Encoding"
+	headerContentPrefix           = "Content-"
+	headerPrecedence              = "Precedence"
+	headerListID                  = "List-Id"
+	headerListUnsubscribe         = "List-Unsubscribe"
+	headerListUnsubscribePost     = "List-Unsubscribe-Post"
+)
+
+const (
+	schemeHTTPS             = "https"
+	listUnsubscribeOneClick = "List-Unsubscribe=One-Click"
+)
+
+// bulkPrecedences are the Precedence values of bulk mail
+var bulkPrecedences = []string{"bulk", "list", "junk"}
+
+const (
+	contentTypeMultipart     = "multipart/"
+	contentTypeMessageRFC822 = "message/rfc822"
+
+	paramBoundary = "boundary"
+	paramCharset  = "charset"
+)
+
+// singleHeaders may occur at most once per RFC 5322 section 3.6
+var singleHeaders = []string{
+	headerDate,
+	headerFrom,
+	headerSender,
+	headerReplyTo,
+	headerTo,
+	headerCc,
+	headerBcc,
+	headerMsgID,
+	headerInReplyTo,
+	headerReferences,
+	headerSubject,
+}
+
+// Lint checks a message read from r and writes the problems found to w. It
+// returns ErrLintFailed if any problem is at least as severe as opts.FailOn.
+func Lint(r io.Reader, w io.Writer, opts Opts) error {
+	if opts.FailOn == "" {
+		opts.FailOn = SeverityError
+	}
+	failRank, ok := severityRank[opts.FailOn]
+	if !ok {
+		return fmt.Errorf("%w: unknown severity %s", ErrInvalidArgs, opts.FailOn)
+	}
+	res, err := Check(r, opts)
+	if err != nil {
+		return err
+	}
+	if opts.JSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(res); err != nil {
+			return fmt.Errorf("Failed writing report: %w", err)
+		}
+	} else {
+		if err := res.WriteReport(w); err != nil {
+			return err
+		}
+	}
+	failed := 0
+	for _, i := range res.Problems {
+		if severityRank[i.Severity] >= failRank {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%w: %d problems at or above %s", ErrLintFailed, failed, opts.FailOn)
+	}
+	return nil
+}
+
+// Check checks a message read from r and returns all problems found
+func Check(r io.Reader, opts Opts) (*Result, error) {
+	if opts.Now.IsZero() {
+		opts.Now = time.Now()
+	}
+	raw, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("Failed reading mail message: %w", err)
+	}
+	l := &linter{
+		opts: opts,
+	}
+	l.checkLines(raw)
+	// errors reading the message that still allow it to be read are
+	// reported when walking its parts
+	m, err := message.Read(bytes.NewReader(raw))
+	if m == nil {
+		l.report(RuleHeaderSyntax, "", err.Error())
+		return l.result(), nil
+	}
+	l.checkHeaders(m.Header)
+	l.checkList(m.Header)
+	if err := inspect.WalkRaw(bytes.NewReader(raw), l.checkPart); err != nil {
+		var perr *inspect.PartError
+		if errors.As(err, &perr) {
+			l.report(RuleBoundary, partLocation(perr.Path), perr.Err.Error())
+		} else {
+			l.report(RuleBoundary, "", err.Error())
+		}
+	}
+	return l.result(), nil
+}
+
+func (l *linter) result() *Result {
+	problems := l.problems
+	if problems == nil {
+		problems = []Problem{}
+	}
+	return &Result{
+		Problems: problems,
+	}
+}
+
+func (l *linter) report(rule string, location string, msg string) {
+	l.problems = append(l.problems, Problem{
+		Rule:     rule,
+		Severity: ruleSeverity[rule],
+		Location: location,
+		Message:  msg,
+	})
+}
+
+func lineLocation(n int) string {
+	return fmt.Sprintf("line %d", n)
+}
+
+func partLocation(path string) string {
+	if path == "" {
+		return "message"
+	}
+	return "part " + path
+}
+
+func (l *linter) checkLines(raw []byte) {
+	hasCRLF := bytes.Contains(raw, []byte("\r\n"))
+	reportLF := l.opts.CRLF || hasCRLF
+	line := 1
+	for len(raw) > 0 {
+		i := bytes.IndexByte(raw, '\n')
+		var content []byte
+		if i < 0 {
+			content = raw
+			raw = nil
+		} else {
+			content = raw[:i]
+			raw = raw[i+1:]
+			if len(content) > 0 && content[len(content)-1] == '\r' {
+				content = content[:len(content)-1]
+			} else if reportLF {
+				l.report(RuleBareLF, lineLocation(line), "Line ends in bare LF")
+			}
+		}
+		if bytes.IndexByte(content, '\r') >= 0 {
+			l.report(RuleBareCR, lineLocation(line), "Line contains bare CR")
+		}
+		if len(content) > maxLineLen {
+			l.report(RuleLineLength, lineLocation(line), fmt.Sprintf("Line is %d octets, over %d", len(content), maxLineLen))
+		}
+		line++
+	}
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+func (l *linter) checkHeaders(h message.Header) {
+	counts := map[string]int{}
+	fields := h.Fields()
+	for fields.Next() {
+		k := textproto.CanonicalMIMEHeaderKey(fields.Key())
+		counts[k]++
+		if !isASCII(fields.Value()) {
+			l.report(RuleHeader8Bit, partLocation(""), fmt.Sprintf("Header %s contains unencoded 8-bit data", fields.Key()))
+		}
+	}
+	for _, i := range singleHeaders {
+		if n := counts[i]; n > 1 {
+			l.report(RuleDuplicateHeader, partLocation(""), fmt.Sprintf("Header %s occurs %d times", i, n))
+		}
+	}
+	for _, i := range []string{headerDate, headerFrom} {
+		if counts[i] == 0 {
+			l.report(RuleMissingHeader, partLocation(""), fmt.Sprintf("Missing %s", i))
+		}
+	}
+	if counts[headerMsgID] == 0 {
+		l.report(RuleMissingMsgID, partLocation(""), "Missing Message-ID")
+	}
+	if counts[headerMIMEVersion] == 0 {
+		for k := range counts {
+			if strings.HasPrefix(k, headerContentPrefix) {
+				l.report(RuleMissingMIME, partLocation(""), fmt.Sprintf("%s without MIME-Version", k))
+				break
+			}
+		}
+	}
+
+	headers := emmail.Header{
+		Header: h,
+	}
+	for _, i := range []string{headerFrom, headerSender, headerReplyTo, headerTo, headerCc, headerBcc} {
+		if _, err := headers.AddressList(i); err != nil {
+			l.report(RuleInvalidHeader, partLocation(""), fmt.Sprintf("Invalid %s: %v", i, err))
+		}
+	}
+	if counts[headerMsgID] > 0 {
+		if id, err := headers.MessageID(); err != nil || id == "" {
+			l.report(RuleInvalidHeader, partLocation(""), "Invalid Message-ID")
+		}
+	}
+	for _, i := range []string{headerInReplyTo, headerReferences} {
+		if _, err := headers.MsgIDList(i); err != nil {
+			l.report(RuleInvalidHeader, partLocation(""), fmt.Sprintf("Invalid %s: %v", i, err))
+		}
+	}
+	if counts[headerDate] > 0 {
+		if t, err := headers.Date(); err != nil {
+			l.report(RuleInvalidHeader, partLocation(""), fmt.Sprintf("Invalid Date: %v", err))
+		} else if t.After(l.opts.Now.Add(dateSkew)) {
+			l.report(RuleDateFuture, partLocation(""), fmt.Sprintf("Date %s is in the future", t.Format(time.RFC1123Z)))
+		}
+	}
+}
+
+// checkList checks the list headers of bulk mail, which is mail with a bulk
+// Precedence or list headers
+func (l *linter) checkList(h message.Header) {
+	loc := partLocation("")
+	bulk := l.opts.Bulk || h.Has(headerListID) || h.Has(headerListUnsubscribe) || h.Has(headerListUnsubscribePost)
+	if p := strings.ToLower(strings.TrimSpace(h.Get(headerPrecedence))); slices.Contains(bulkPrecedences, p) {
+		bulk = true
+	}
+	hasHTTPS := false
+	if v := h.Get(headerListUnsubscribe); v != "" {
+		uris, ok := parseListURIs(v)
+		if !ok {
+			l.report(RuleInvalidListHeader, loc, fmt.Sprintf("Invalid List-Unsubscribe %s", v))
+		}
+		for _, i := range uris {
+			if u, err := url.Parse(i); err == nil && u.Scheme == schemeHTTPS {
+				hasHTTPS = true
+			}
+		}
+	}
+	if v := h.Get(headerListID); v != "" {
+		if i := strings.LastIndexByte(v, '<'); i < 0 || !strings.HasSuffix(v, ">") || !strings.Contains(v[i:], ".") {
+			l.report(RuleInvalidListHeader, loc, fmt.Sprintf("Invalid List-Id %s", v))
+		}
+	}
+	if h.Has(headerListUnsubscribePost) {
+		if v := strings.TrimSpace(h.Get(headerListUnsubscribePost)); v != listUnsubscribeOneClick {
+			l.report(RuleListUnsubscribePost, loc, fmt.Sprintf("List-Unsubscribe-Post is %q instead of %q", v, listUnsubscribeOneClick))
+		} else if !hasHTTPS {
+			l.report(RuleListUnsubscribePost, loc, "List-Unsubscribe-Post without an https List-Unsubscribe url")
+		}
+	}
+	if !bulk {
+		return
+	}
+	if !h.Has(headerListUnsubscribe) {
+		l.report(RuleListUnsubscribe, loc, "Bulk mail without List-Unsubscribe")
+	} else if !hasHTTPS {
+		l.report(RuleOneClick, loc, "Bulk mail without an https List-Unsubscribe url")
+	} else if !h.Has(headerListUnsubscribePost) {
+		l.report(RuleOneClick, loc, "Bulk mail without List-Unsubscribe-Post")
+	}
+	if !h.Has(headerListID) {
+		l.report(RuleListID, loc, "Bulk mail without List-Id")
+	}
+}
+
+// parseListURIs parses a comma separated list of <uri> of RFC 2369
+func parseListURIs(v string) ([]string, bool) {
+	var uris []string
+	for _, i := range strings.Split(v, ",") {
+		i = strings.TrimSpace(i)
+		if len(i) < 2 || i[0] != '<' || i[len(i)-1] != '>' {
+			return uris, false
+		}
+		uris = append(uris, i[1:len(i)-1])
+	}
+	return uris, len(uris) > 0
+}
+
+func (l *linter) reportPartErr(path string, err error) {
+	switch {
+	case message.IsUnknownCharset(err):
+		l.report(RuleUnknownCharset, partLocation(path), err.Error())
+	case message.IsUnknownEncoding(err):
+		l.report(RuleUnknownEncoding, partLocation(path), err.Error())
+	default:
+		l.report(RuleHeaderSyntax, partLocation(path), err.Error())
+	}
+}
+
+// validBoundary checks a boundary against the bchars of RFC 2046
+func validBoundary(b string) bool {
+	if len(b) == 0 || len(b) > maxBoundaryLen || strings.HasSuffix(b, " ") {
+		return false
+	}
+	for _, c := range b {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case strings.ContainsRune("'()+_,-./:=? ", c):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func (l *linter) checkPart(path string, e *message.Entity, raw *bytes.Buffer, partErr error) (bool, error) {
+	loc := partLocation(path)
+	if partErr != nil {
+		l.reportPartErr(path, partErr)
+	}
+	t, params, err := e.Header.ContentType()
+	if err != nil {
+		l.report(RuleContentType, loc, fmt.Sprintf("Invalid Content-Type: %v", err))
+		return false, nil
+	}
+	enc := strings.ToLower(strings.TrimSpace(e.Header.Get(headerContentTransferEncoding)))
+	if strings.HasPrefix(t, contentTypeMultipart) {
+		switch enc {
+		case "", "7bit", "8bit", "binary":
+		default:
+			l.report(RuleMultipartEncoding, loc, fmt.Sprintf("Multipart with Content-Transfer-Encoding %s", enc))
+		}
+		if b := params[paramBoundary]; !validBoundary(b) {
+			l.report(RuleBoundary, loc, fmt.Sprintf("Invalid boundary %q", b))
+			return false, nil
+		}
+		return true, nil
+	}
+	if t == contentTypeMessageRFC822 {
+		return true, nil
+	}
+	if _, err := io.Copy(io.Discard, e.Body); err != nil {
+		l.report(RuleBodyEncoding, loc, fmt.Sprintf("Failed decoding body: %v", err))
+		return false, nil
+	}
+	// the raw body is checked since the decoded body is converted from its
+	// charset
+	if (enc == "" || enc == "7bit") && !isASCII(raw.String()) {
+		l.report(RuleBody8Bit, loc, "8-bit data without an 8bit Content-Transfer-Encoding")
+	}
+	return false, nil
+}
+
+// WriteReport writes a human readable report
+func (r *Result) WriteReport(w io.Writer) error {
+	counts := map[Severity]int{}
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for _, i := range r.Problems {
+		counts[i.Severity]++
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", i.Severity, i.Rule, i.Location, i.Message)
+	}
+	if err := tw.Flush(); err != nil {
+		return fmt.Errorf("Failed writing report: %w", err)
+	}
+	if _, err := fmt.Fprintf(w, "%d errors, %d warnings, %d info\n", counts[SeverityError], counts[SeverityWarning], counts[SeverityInfo]); err != nil {
+		return fmt.Errorf("Failed writing report: %w", err)
+	}
+	return nil
+}
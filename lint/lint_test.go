@@ -0,0 +1,132 @@
+package lint
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Check(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+	for _, tc := range []struct {
+		Name  string
+		CRLF  bool
+		Bulk  bool
+		Inp   string
+		Rules []string
+	}{
+		{
+			Name: "Valid message",
+			Inp:  "From: a@example.com\nTo: b@example.com\nSubject: hi\nDate: Mon, 01 Jan 2024 00:00:00 +0000\nMessage-ID: <a@example.com>\n\nhi\n",
+		},
+		{
+			Name:  "Bare LF when CRLF is required",
+			CRLF:  true,
+			Inp:   "From: a@example.com\r\nDate: Mon, 01 Jan 2024 00:00:00 +0000\r\nMessage-ID: <a@example.com>\n\r\nhi\r\n",
+			Rules: []string{RuleBareLF},
+		},
+		{
+			Name:  "Header problems",
+			Inp:   "From: a@example.com\nSubject: a\nSubject: b\nTo: not an address\nDate: Mon, 01 Jan 2024 01:00:00 +0000\n\nhi\n",
+			Rules: []string{RuleDuplicateHeader, RuleMissingMsgID, RuleInvalidHeader, RuleDateFuture},
+		},
+		{
+			Name:  "Long lines and unencoded 8-bit",
+			Inp:   "From: a@example.com\nSubject: caf\xc3\xa9\nDate: Mon, 01 Jan 2024 00:00:00 +0000\nMessage-ID: <a@example.com>\n\ncaf\xc3\xa9 " + strings.Repeat("a", 1000) + "\n",
+			Rules: []string{RuleLineLength, RuleHeader8Bit, RuleBody8Bit},
+		},
+		{
+			Name:  "Unencoded 8-bit in a non UTF-8 charset",
+			Inp:   "From: a@example.com\nDate: Mon, 01 Jan 2024 00:00:00 +0000\nMessage-ID: <a@example.com>\nMIME-Version: 1.0\nContent-Type: text/plain; charset=iso-8859-1\nContent-Transfer-Encoding: 7bit\n\ncaf\xe9\n",
+			Rules: []string{RuleBody8Bit},
+		},
+		{
+			Name: "Encoded 8-bit in a non UTF-8 charset",
+			Inp:  "From: a@example.com\nDate: Mon, 01 Jan 2024 00:00:00 +0000\nMessage-ID: <a@example.com>\nMIME-Version: 1.0\nContent-Type: text/plain; charset=iso-8859-1\nContent-Transfer-Encoding: quoted-printable\n\ncaf=E9\n",
+		},
+		{
+			Name:  "MIME problems",
+			Inp:   "From: a@example.com\nDate: Mon, 01 Jan 2024 00:00:00 +0000\nMessage-ID: <a@example.com>\nContent-Type: multipart/mixed; boundary=a\nContent-Transfer-Encoding: base64\n\n--a\nContent-Type: text/plain; charset=bogus\n\nhi\n--a\nContent-Type: text/plain\nContent-Transfer-Encoding: base64\n\n!!!!\n--a--\n",
+			Rules: []string{RuleMissingMIME, RuleMultipartEncoding, RuleUnknownCharset, RuleBodyEncoding},
+		},
+		{
+			Name:  "Bulk mail without list headers",
+			Inp:   "From: a@example.com\nDate: Mon, 01 Jan 2024 00:00:00 +0000\nMessage-ID: <a@example.com>\nPrecedence: bulk\n\nhi\n",
+			Rules: []string{RuleListUnsubscribe, RuleListID},
+		},
+		{
+			Name:  "Bulk mail without one click unsubscribe",
+			Bulk:  true,
+			Inp:   "From: a@example.com\nDate: Mon, 01 Jan 2024 00:00:00 +0000\nMessage-ID: <a@example.com>\nList-Id: <news.example.com>\nList-Unsubscribe: <mailto:u@example.com>\nList-Unsubscribe-Post: List-Unsubscribe=One-Click\n\nhi\n",
+			Rules: []string{RuleListUnsubscribePost, RuleOneClick},
+		},
+		{
+			Name: "Bulk mail with one click unsubscribe",
+			Inp:  "From: a@example.com\nDate: Mon, 01 Jan 2024 00:00:00 +0000\nMessage-ID: <a@example.com>\nList-Id: News <news.example.com>\nList-Unsubscribe: <mailto:u@example.com>, <https://example.com/u>\nList-Unsubscribe-Post: List-Unsubscribe=One-Click\n\nhi\n",
+		},
+	} {
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			assert := require.New(t)
+
+			res, err := Check(strings.NewReader(tc.Inp), Opts{
+				CRLF: tc.CRLF,
+				Bulk: tc.Bulk,
+				Now:  now,
+			})
+			assert.NoError(err)
+			var rules []string
+			for _, i := range res.Problems {
+				rules = append(rules, i.Rule)
+			}
+			assert.Equal(tc.Rules, rules)
+		})
+	}
+}
+
+func Test_CheckMultipartLocation(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		Name     string
+		Inp      string
+		Location string
+		Message  string
+	}{
+		{
+			Name:     "Top level multipart",
+			Inp:      "From: a@example.com\nDate: Mon, 01 Jan 2024 00:00:00 +0000\nMessage-ID: <a@example.com>\nMIME-Version: 1.0\nContent-Type: multipart/mixed; boundary=a\n\nno parts\n",
+			Location: "message",
+			Message:  "Failed reading multipart: multipart: NextPart: EOF",
+		},
+		{
+			Name:     "Nested multipart",
+			Inp:      "From: a@example.com\nDate: Mon, 01 Jan 2024 00:00:00 +0000\nMessage-ID: <a@example.com>\nMIME-Version: 1.0\nContent-Type: multipart/mixed; boundary=a\n\n--a\nContent-Type: text/plain\n\nhi\n--a\nContent-Type: multipart/alternative; boundary=b\n\nno parts\n--a--\n",
+			Location: "part 2",
+			Message:  "Failed reading multipart: multipart: NextPart: EOF",
+		},
+	} {
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			assert := require.New(t)
+
+			res, err := Check(strings.NewReader(tc.Inp), Opts{
+				Now: time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC),
+			})
+			assert.NoError(err)
+			assert.Equal([]Problem{
+				{
+					Rule:     RuleBoundary,
+					Severity: ruleSeverity[RuleBoundary],
+					Location: tc.Location,
+					Message:  tc.Message,
+				},
+			}, res.Problems)
+		})
+	}
+}
@@ -0,0 +1,347 @@
+// Package mailcattest provides utilities for golden file testing of mail
+// messages
+package mailcattest
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"mime/quotedprintable"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-message"
+	emmail "github.com/emersion/go-message/mail"
+	"github.com/emersion/go-message/textproto"
+	"golang.org/x/text/transform"
+	"xorkevin.dev/mailcat/formatter"
+	"xorkevin.dev/mailcat/inspect"
+	"xorkevin.dev/mailcat/transformer"
+)
+
+type (
+	// normalizer rewrites generated values of a message
+	normalizer struct {
+		ids        map[string]string
+		replacer   *strings.Replacer
+		msgids     int
+		cids       int
+		boundaries int
+	}
+)
+
+const (
+	// MsgIDDomain is the domain of normalized Message-IDs and Content-IDs
+	MsgIDDomain = "mailcat.test"
+)
+
+var (
+	// Date is the normalized Date of messages
+	Date = time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC)
+)
+
+const (
+	headerMsgID                   = "Message-Id"
+	headerContentID               = "Content-Id"
+	headerContentType             = "Content-Type"
+	headerContentTransferEncoding = "Content-Transfer-Encoding"
+	headerDate                    = "Date"
+
+	contentTypeText          = "text/"
+	contentTypeMultipart     = "multipart/"
+	contentTypeMessageRFC822 = "message/rfc822"
+
+	paramBoundary = "boundary"
+
+	encodingQuotedPrintable = "quoted-printable"
+	encodingBase64          = "base64"
+
+	base64LineLen = 76
+)
+
+const (
+	// maxDepth is the maximum nesting of parts
+	maxDepth = 64
+)
+
+// Normalize reads a message from r and writes it to w with CRLF line endings
+// and canonical headers, replacing the values generated on every run,
+// Message-IDs, Content-IDs, the Date, and multipart boundaries, with
+// deterministic ones. Message-IDs and Content-IDs are numbered in order of
+// appearance, and every occurrence of them in header values and text bodies,
+// such as in References and cid: URLs, is replaced. Other bodies are written
+// unchanged.
+func Normalize(r io.Reader, w io.Writer) error {
+	var m bytes.Buffer
+	if _, err := io.Copy(&m, transform.NewReader(r, transformer.CRLF{})); err != nil {
+		return fmt.Errorf("Failed reading mail message: %w", err)
+	}
+	n := &normalizer{
+		ids: map[string]string{},
+	}
+	// the first pass collects the generated ids which may be referenced
+	// before they are declared
+	if err := n.normalizeMsg(bufio.NewReader(bytes.NewReader(m.Bytes())), io.Discard, 0); err != nil {
+		return err
+	}
+	pairs := make([]string, 0, len(n.ids)*2)
+	for k, v := range n.ids {
+		pairs = append(pairs, k, v)
+	}
+	n.replacer = strings.NewReplacer(pairs...)
+	n.boundaries = 0
+	if err := n.normalizeMsg(bufio.NewReader(bytes.NewReader(m.Bytes())), w, 0); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (n *normalizer) normalizeMsg(r *bufio.Reader, w io.Writer, depth int) error {
+	h, err := textproto.ReadHeader(r)
+	if err != nil {
+		return fmt.Errorf("Failed reading mail message header: %w", err)
+	}
+	headers := emmail.Header{
+		Header: message.Header{
+			Header: h,
+		},
+	}
+	if err := formatter.CanonicalizeHeader(&headers); err != nil {
+		return err
+	}
+	if msgid, err := headers.MessageID(); err == nil && msgid != "" {
+		n.addMsgID(msgid)
+	}
+	if headers.Has(headerDate) {
+		headers.SetDate(Date)
+	}
+	boundary := n.normalizeHeader(&headers.Header)
+	if err := textproto.WriteHeader(w, headers.Header.Header); err != nil {
+		return fmt.Errorf("Failed writing header: %w", err)
+	}
+	return n.normalizeBody(headers.Header, boundary, r, w, depth)
+}
+
+func (n *normalizer) addMsgID(id string) {
+	if _, ok := n.ids[id]; ok {
+		return
+	}
+	n.msgids++
+	n.ids[id] = fmt.Sprintf("msgid-%d@%s", n.msgids, MsgIDDomain)
+}
+
+func (n *normalizer) addContentID(id string) {
+	if _, ok := n.ids[id]; ok {
+		return
+	}
+	n.cids++
+	n.ids[id] = fmt.Sprintf("cid-%d@%s", n.cids, MsgIDDomain)
+}
+
+// normalizeHeader replaces the generated values of an entity header and
+// returns the original multipart boundary if any
+func (n *normalizer) normalizeHeader(h *message.Header) string {
+	if cids, err := (&emmail.Header{Header: *h}).MsgIDList(headerContentID); err == nil {
+		for _, i := range cids {
+			n.addContentID(i)
+		}
+	}
+	n.replaceHeader(h)
+	t, params, _ := h.ContentType()
+	if !strings.HasPrefix(t, contentTypeMultipart) || params[paramBoundary] == "" {
+		return ""
+	}
+	boundary := params[paramBoundary]
+	n.boundaries++
+	params[paramBoundary] = fmt.Sprintf("boundary-%d", n.boundaries)
+	h.SetContentType(t, params)
+	return boundary
+}
+
+// replaceHeader replaces ids in header values, leaving fields without ids
+// unchanged
+func (n *normalizer) replaceHeader(h *message.Header) {
+	if n.replacer == nil {
+		return
+	}
+	type field struct {
+		key   string
+		value string
+		raw   []byte
+	}
+	var fields []field
+	modified := false
+	i := h.Fields()
+	for i.Next() {
+		v := i.Value()
+		if r := n.replacer.Replace(v); r != v {
+			fields = append(fields, field{key: i.Key(), value: r})
+			modified = true
+			continue
+		}
+		raw, err := i.Raw()
+		if err != nil {
+			fields = append(fields, field{key: i.Key(), value: v})
+			continue
+		}
+		fields = append(fields, field{key: i.Key(), raw: raw})
+	}
+	if !modified {
+		return
+	}
+	i = h.Fields()
+	for i.Next() {
+		i.Del()
+	}
+	// fields are prepended, so add in reverse to preserve order
+	for j := len(fields) - 1; j >= 0; j-- {
+		if fields[j].raw != nil {
+			h.AddRaw(fields[j].raw)
+		} else {
+			h.Add(fields[j].key, fields[j].value)
+		}
+	}
+}
+
+func (n *normalizer) normalizeBody(h message.Header, boundary string, r *bufio.Reader, w io.Writer, depth int) error {
+	if depth > maxDepth {
+		return fmt.Errorf("Message exceeds max depth %d", maxDepth)
+	}
+	if boundary != "" {
+		_, params, _ := h.ContentType()
+		mw := textproto.NewMultipartWriter(w)
+		if err := mw.SetBoundary(params[paramBoundary]); err != nil {
+			return fmt.Errorf("Invalid boundary: %w", err)
+		}
+		mr := textproto.NewMultipartReader(r, boundary)
+		for {
+			p, err := mr.NextPart()
+			if err != nil {
+				if errors.Is(err, io.EOF) {
+					break
+				}
+				return fmt.Errorf("Failed reading multipart: %w", err)
+			}
+			ph := message.Header{
+				Header: p.Header,
+			}
+			pb := n.normalizeHeader(&ph)
+			pw, err := mw.CreatePart(ph.Header)
+			if err != nil {
+				return fmt.Errorf("Failed writing part: %w", err)
+			}
+			if err := n.normalizeBody(ph, pb, bufio.NewReader(p), pw, depth+1); err != nil {
+				return err
+			}
+		}
+		if err := mw.Close(); err != nil {
+			return fmt.Errorf("Failed writing multipart: %w", err)
+		}
+		return nil
+	}
+	t, _, _ := h.ContentType()
+	if t == contentTypeMessageRFC822 && isIdentityEncoding(h.Get(headerContentTransferEncoding)) {
+		return n.normalizeMsg(r, w, depth+1)
+	}
+	if n.replacer != nil && strings.HasPrefix(t, contentTypeText) {
+		// ids are only replaced in text, and encoded text may split them across
+		// lines
+		switch strings.ToLower(strings.TrimSpace(h.Get(headerContentTransferEncoding))) {
+		case encodingQuotedPrintable:
+			b, err := io.ReadAll(quotedprintable.NewReader(r))
+			if err != nil {
+				return fmt.Errorf("Failed decoding body: %w", err)
+			}
+			qw := quotedprintable.NewWriter(w)
+			if _, err := io.WriteString(qw, n.replacer.Replace(string(b))); err != nil {
+				return fmt.Errorf("Failed writing body: %w", err)
+			}
+			if err := qw.Close(); err != nil {
+				return fmt.Errorf("Failed writing body: %w", err)
+			}
+			return nil
+		case "", "7bit", "8bit", "binary":
+			b, err := io.ReadAll(r)
+			if err != nil {
+				return fmt.Errorf("Failed reading body: %w", err)
+			}
+			if _, err := io.WriteString(w, n.replacer.Replace(string(b))); err != nil {
+				return fmt.Errorf("Failed writing body: %w", err)
+			}
+			return nil
+		case encodingBase64:
+			b, err := io.ReadAll(base64.NewDecoder(base64.StdEncoding, r))
+			if err != nil {
+				return fmt.Errorf("Failed decoding body: %w", err)
+			}
+			e := base64.StdEncoding.EncodeToString([]byte(n.replacer.Replace(string(b))))
+			for len(e) > 0 {
+				l := min(len(e), base64LineLen)
+				if _, err := io.WriteString(w, e[:l]+"\r\n"); err != nil {
+					return fmt.Errorf("Failed writing body: %w", err)
+				}
+				e = e[l:]
+			}
+			return nil
+		}
+	}
+	if _, err := io.Copy(w, r); err != nil {
+		return fmt.Errorf("Failed writing body: %w", err)
+	}
+	return nil
+}
+
+func isIdentityEncoding(enc string) bool {
+	switch strings.ToLower(strings.TrimSpace(enc)) {
+	case "", "7bit", "8bit", "binary":
+		return true
+	}
+	return false
+}
+
+// Golden normalizes the message msg and compares it against the golden file,
+// failing the test if they differ. If update is set, the golden file is
+// written instead. Test packages commonly pass the value of their own -update
+// flag.
+func Golden(t testing.TB, file string, msg []byte, update bool) {
+	t.Helper()
+
+	var b bytes.Buffer
+	if err := Normalize(bytes.NewReader(msg), &b); err != nil {
+		t.Fatalf("Failed to normalize message: %v", err)
+	}
+	if update {
+		if err := os.MkdirAll(filepath.Dir(file), 0o777); err != nil {
+			t.Fatalf("Failed to create golden file dir: %v", err)
+		}
+		if err := os.WriteFile(file, b.Bytes(), 0o666); err != nil {
+			t.Fatalf("Failed to write golden file %s: %v", file, err)
+		}
+		return
+	}
+	golden, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatalf("Failed to read golden file %s: %v", file, err)
+	}
+	// golden files may have had their line endings changed by version control
+	var g bytes.Buffer
+	if _, err := io.Copy(&g, transform.NewReader(bytes.NewReader(golden), transformer.CRLF{})); err != nil {
+		t.Fatalf("Failed to read golden file %s: %v", file, err)
+	}
+	if bytes.Equal(g.Bytes(), b.Bytes()) {
+		return
+	}
+	var d strings.Builder
+	if err := inspect.Diff(bytes.NewReader(g.Bytes()), bytes.NewReader(b.Bytes()), &d, inspect.DiffOpts{}); err == nil {
+		// the messages differ only in their formatting
+		t.Errorf("Message does not match golden file %s\n--- golden\n%s\n+++ actual\n%s", file, g.String(), b.String())
+		return
+	}
+	t.Errorf("Message does not match golden file %s\n%s", file, d.String())
+}
@@ -0,0 +1,81 @@
+package mailcattest
+
+import (
+	"bytes"
+	"flag"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"xorkevin.dev/mailcat/formatter"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+func Test_Golden(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		Name   string
+		Inp    string
+		Golden string
+	}{
+		{
+			Name: "Html with inline parts and attachments",
+			Inp: `{
+  "from": "Bob <bob@example.com>",
+  "to": "alice@example.com",
+  "subject": "Hello",
+  "text": "hi\n",
+  "html": "<p>hi <img src=\"dot.png\"></p>",
+  "attachments": [
+    {"name": "dot.png", "content": "iVBORw0KGgo=", "inline": true},
+    {"name": "notes.txt", "content": "aGVsbG8K"}
+  ]
+}`,
+			Golden: "testdata/html.eml",
+		},
+	} {
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			assert := require.New(t)
+
+			var b bytes.Buffer
+			assert.NoError(formatter.Format(strings.NewReader(tc.Inp), &b, formatter.Opts{
+				JSON:        true,
+				MsgIDDomain: "mail.example.com",
+			}))
+			Golden(t, tc.Golden, b.Bytes(), *update)
+		})
+	}
+}
+
+func Test_Normalize(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		Name string
+		Inp  string
+		Exp  string
+	}{
+		{
+			Name: "Replaces ids in header values and text bodies",
+			Inp:  "Message-ID: <m1@example.com>\nIn-Reply-To: <m0@example.com>\nReferences:\n <m0@example.com>\nX-Note: m1@example.com\nSubject: m2@example.com\nContent-Type: text/plain\n\nsee <m1@example.com>\n",
+			Exp:  "Subject: m2@example.com\r\nMessage-Id: <msgid-1@mailcat.test>\r\nIn-Reply-To: <m0@example.com>\r\nReferences: <m0@example.com>\r\nContent-Type: text/plain\r\nX-Note: msgid-1@mailcat.test\r\n\r\nsee <msgid-1@mailcat.test>\r\n",
+		},
+		{
+			Name: "Leaves non-text bodies unchanged",
+			Inp:  "Message-ID: <m1@example.com>\nContent-Type: multipart/mixed; boundary=XX\n\n--XX\nContent-Type: text/html\nContent-Transfer-Encoding: base64\n\nPGEgaHJlZj0ibTFAZXhhbXBsZS5jb20iPg==\n--XX\nContent-Type: application/octet-stream\n\nm1@example.com\n--XX\nContent-Type: application/octet-stream\nContent-Transfer-Encoding: base64\n\nbTFAZXhhbXBsZS5jb20=\n--XX--\n",
+			Exp:  "Content-Type: multipart/mixed; boundary=boundary-1\r\nSubject: \r\nMessage-Id: <msgid-1@mailcat.test>\r\n\r\n--boundary-1\r\nContent-Type: text/html\r\nContent-Transfer-Encoding: base64\r\n\r\nPGEgaHJlZj0ibXNnaWQtMUBtYWlsY2F0LnRlc3QiPg==\r\n\r\n--boundary-1\r\nContent-Type: application/octet-stream\r\n\r\nm1@example.com\r\n--boundary-1\r\nContent-Type: application/octet-stream\r\nContent-Transfer-Encoding: base64\r\n\r\nbTFAZXhhbXBsZS5jb20=\r\n--boundary-1--\r\n",
+		},
+	} {
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			assert := require.New(t)
+
+			var b bytes.Buffer
+			assert.NoError(Normalize(strings.NewReader(tc.Inp), &b))
+			assert.Equal(tc.Exp, b.String())
+		})
+	}
+}
@@ -0,0 +1,255 @@
+package mbox
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+type (
+	// Reader reads messages from an mboxrd formatted stream
+	Reader struct {
+		r       *bufio.Reader
+		cur     *msgReader
+		started bool
+		done    bool
+	}
+
+	msgReader struct {
+		r       *Reader
+		buf     []byte
+		pending []byte
+		eof     bool
+	}
+
+	// Writer writes messages as an mboxrd formatted stream
+	Writer struct {
+		w   io.Writer
+		cur *msgWriter
+	}
+
+	msgWriter struct {
+		w      io.Writer
+		line   []byte
+		closed bool
+	}
+)
+
+var (
+	ErrInvalidMbox = errors.New("Invalid mbox")
+	ErrMsgOpen     = errors.New("Previous message not closed")
+)
+
+var (
+	fromLinePrefix = []byte("From ")
+)
+
+const (
+	fromLineTimeLayout = time.ANSIC
+	defaultFromSender  = "MAILER-DAEMON"
+)
+
+// IsMbox returns true if the beginning of a stream looks like an mbox
+func IsMbox(prefix []byte) bool {
+	return bytes.HasPrefix(prefix, fromLinePrefix)
+}
+
+// NewReader creates a new mbox reader
+func NewReader(r io.Reader) *Reader {
+	return &Reader{
+		r: bufio.NewReader(r),
+	}
+}
+
+// Next returns a reader for the next message, discarding any unread content
+// of the previous message. It returns [io.EOF] when there are no more
+// messages.
+func (r *Reader) Next() (io.Reader, error) {
+	if r.cur != nil {
+		if _, err := io.Copy(io.Discard, r.cur); err != nil {
+			return nil, err
+		}
+		r.cur = nil
+	}
+	if r.done {
+		return nil, io.EOF
+	}
+	if !r.started {
+		r.started = true
+		line, err := r.readLine()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				r.done = true
+			}
+			return nil, err
+		}
+		if !bytes.HasPrefix(line, fromLinePrefix) {
+			return nil, fmt.Errorf("%w: missing From line", ErrInvalidMbox)
+		}
+	}
+	r.cur = &msgReader{
+		r: r,
+	}
+	return r.cur, nil
+}
+
+// readLine reads a full line including the line ending
+func (r *Reader) readLine() ([]byte, error) {
+	line, err := r.r.ReadBytes('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("Failed reading mbox: %w", err)
+	}
+	if len(line) == 0 {
+		return nil, io.EOF
+	}
+	return line, nil
+}
+
+func isBlankLine(line []byte) bool {
+	return bytes.Equal(line, []byte("\n")) || bytes.Equal(line, []byte("\r\n"))
+}
+
+// unquoteFrom removes a level of mboxrd quoting from a >From line
+func unquoteFrom(line []byte) []byte {
+	if bytes.HasPrefix(bytes.TrimLeft(line, ">"), fromLinePrefix) && line[0] == '>' {
+		return line[1:]
+	}
+	return line
+}
+
+// nextLine returns the next unquoted line of the message, holding back a blank
+// line until it is known not to be the separator before the next From line
+func (m *msgReader) nextLine() ([]byte, error) {
+	if m.eof {
+		return nil, io.EOF
+	}
+	var line []byte
+	if m.pending != nil {
+		line = m.pending
+		m.pending = nil
+	} else {
+		l, err := m.r.readLine()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				m.eof = true
+				m.r.done = true
+			}
+			return nil, err
+		}
+		line = l
+	}
+	if bytes.HasPrefix(line, fromLinePrefix) {
+		m.eof = true
+		return nil, io.EOF
+	}
+	if isBlankLine(line) {
+		next, err := m.r.readLine()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				m.eof = true
+				m.r.done = true
+			}
+			return nil, err
+		}
+		if bytes.HasPrefix(next, fromLinePrefix) {
+			m.eof = true
+			return nil, io.EOF
+		}
+		m.pending = next
+	}
+	return unquoteFrom(line), nil
+}
+
+func (m *msgReader) Read(p []byte) (int, error) {
+	for len(m.buf) == 0 {
+		line, err := m.nextLine()
+		if err != nil {
+			return 0, err
+		}
+		m.buf = line
+	}
+	n := copy(p, m.buf)
+	m.buf = m.buf[n:]
+	return n, nil
+}
+
+// NewWriter creates a new mbox writer
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{
+		w: w,
+	}
+}
+
+// Create begins a new message with a From line of the envelope sender and
+// delivery time. The returned writer must be closed before the next message
+// is created.
+func (w *Writer) Create(sender string, t time.Time) (io.WriteCloser, error) {
+	if w.cur != nil && !w.cur.closed {
+		return nil, ErrMsgOpen
+	}
+	if sender == "" {
+		sender = defaultFromSender
+	}
+	if _, err := fmt.Fprintf(w.w, "From %s %s\n", sender, t.UTC().Format(fromLineTimeLayout)); err != nil {
+		return nil, fmt.Errorf("Failed writing mbox: %w", err)
+	}
+	w.cur = &msgWriter{
+		w: w.w,
+	}
+	return w.cur, nil
+}
+
+func (m *msgWriter) writeLine(line []byte) error {
+	if bytes.HasPrefix(bytes.TrimLeft(line, ">"), fromLinePrefix) {
+		if _, err := m.w.Write([]byte{'>'}); err != nil {
+			return fmt.Errorf("Failed writing mbox: %w", err)
+		}
+	}
+	if _, err := m.w.Write(line); err != nil {
+		return fmt.Errorf("Failed writing mbox: %w", err)
+	}
+	return nil
+}
+
+func (m *msgWriter) Write(p []byte) (int, error) {
+	if m.closed {
+		return 0, io.ErrClosedPipe
+	}
+	n := len(p)
+	for len(p) > 0 {
+		i := bytes.IndexByte(p, '\n')
+		if i < 0 {
+			m.line = append(m.line, p...)
+			break
+		}
+		m.line = append(m.line, p[:i+1]...)
+		p = p[i+1:]
+		if err := m.writeLine(m.line); err != nil {
+			return 0, err
+		}
+		m.line = m.line[:0]
+	}
+	return n, nil
+}
+
+// Close ends the message, terminating it with the blank separator line
+func (m *msgWriter) Close() error {
+	if m.closed {
+		return nil
+	}
+	m.closed = true
+	if len(m.line) > 0 {
+		m.line = append(m.line, '\n')
+		if err := m.writeLine(m.line); err != nil {
+			return err
+		}
+		m.line = nil
+	}
+	if _, err := m.w.Write([]byte{'\n'}); err != nil {
+		return fmt.Errorf("Failed writing mbox: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package mbox
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Reader(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		Name string
+		Inp  string
+		Exp  []string
+	}{
+		{
+			Name: "Multiple messages with quoted From lines",
+			Inp:  "From a@example.com Mon Jan  2 15:04:05 2006\nSubject: one\n\nbody\n>From here\n>>From there\n\nFrom b@example.com Mon Jan  2 15:04:05 2006\nSubject: two\n\n\nbody two\n\n",
+			Exp: []string{
+				"Subject: one\n\nbody\nFrom here\n>From there\n",
+				"Subject: two\n\n\nbody two\n",
+			},
+		},
+		{
+			Name: "Empty",
+			Inp:  "",
+			Exp:  nil,
+		},
+	} {
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			assert := require.New(t)
+
+			r := NewReader(strings.NewReader(tc.Inp))
+			var msgs []string
+			for {
+				m, err := r.Next()
+				if err == io.EOF {
+					break
+				}
+				assert.NoError(err)
+				b, err := io.ReadAll(m)
+				assert.NoError(err)
+				msgs = append(msgs, string(b))
+			}
+			assert.Equal(tc.Exp, msgs)
+		})
+	}
+}
+
+func Test_Reader_Invalid(t *testing.T) {
+	t.Parallel()
+	assert := require.New(t)
+
+	_, err := NewReader(strings.NewReader("Subject: one\n\nbody\n")).Next()
+	assert.ErrorIs(err, ErrInvalidMbox)
+}
+
+func Test_Writer(t *testing.T) {
+	t.Parallel()
+	assert := require.New(t)
+
+	msgs := []string{
+		"Subject: one\n\nbody\nFrom here\n>From there\n",
+		"Subject: two\n\nno trailing newline",
+	}
+
+	var b bytes.Buffer
+	w := NewWriter(&b)
+	for _, i := range msgs {
+		m, err := w.Create("a@example.com", time.Unix(0, 0))
+		assert.NoError(err)
+		_, err = io.WriteString(m, i)
+		assert.NoError(err)
+		assert.NoError(m.Close())
+	}
+	assert.Equal("From a@example.com Thu Jan  1 00:00:00 1970\nSubject: one\n\nbody\n>From here\n>>From there\n\nFrom a@example.com Thu Jan  1 00:00:00 1970\nSubject: two\n\nno trailing newline\n\n", b.String())
+
+	r := NewReader(&b)
+	for n, i := range msgs {
+		m, err := r.Next()
+		assert.NoError(err)
+		out, err := io.ReadAll(m)
+		assert.NoError(err)
+		if n == 1 {
+			i += "\n"
+		}
+		assert.Equal(i, string(out))
+	}
+	_, err := r.Next()
+	assert.Equal(io.EOF, err)
+}
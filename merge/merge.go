@@ -0,0 +1,274 @@
+package merge
+
+import (
+	"bytes"
+	"crypto"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+
+	"xorkevin.dev/mailcat/formatter"
+	"xorkevin.dev/mailcat/mbox"
+	"xorkevin.dev/mailcat/send"
+)
+
+type (
+	// Opts are mail merge options. Messages are written to Dir, to Mbox, or
+	// sent to Send.Addr, and otherwise as an mbox to the output writer.
+	Opts struct {
+		CSV    string
+		Dir    string
+		Mbox   string
+		Format formatter.Opts
+		Send   send.Opts
+	}
+
+	// sink receives formatted messages
+	sink interface {
+		put(n int, msg []byte) error
+		close() error
+	}
+
+	dirSink struct {
+		dir string
+	}
+
+	mboxSink struct {
+		f   io.Closer
+		w   *mbox.Writer
+		now func() time.Time
+	}
+
+	sendSink struct {
+		sess     *send.Session
+		from     string
+		to       string
+		selector string
+		signer   crypto.Signer
+	}
+)
+
+var (
+	ErrInvalidArgs = errors.New("Invalid args")
+	ErrInvalidCSV  = errors.New("Invalid csv")
+)
+
+const (
+	msgFileFmt = "%06d.eml"
+)
+
+// Merge renders the message template read from r once per row of the csv
+// file, with the row as template data keyed by the csv header over any
+// template data of the format opts. Each message is formatted with its own
+// Message-ID and Date. Rows fail if their fields render line breaks into
+// headers, since quoted csv fields may contain line breaks. Merging continues
+// past failed rows, and all failures are returned.
+func Merge(r io.Reader, w io.Writer, opts Opts) (retErr error) {
+	if opts.CSV == "" {
+		return fmt.Errorf("%w: no csv file", ErrInvalidArgs)
+	}
+	outputs := 0
+	for _, i := range []string{opts.Dir, opts.Mbox, opts.Send.Addr} {
+		if i != "" {
+			outputs++
+		}
+	}
+	if outputs > 1 {
+		return fmt.Errorf("%w: only one of dir, mbox, and server may be provided", ErrInvalidArgs)
+	}
+	t, err := formatter.ParseTemplate(r)
+	if err != nil {
+		return err
+	}
+	base, err := formatter.ReadTemplateData(opts.Format.TemplateData, opts.Format.Vars)
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(opts.CSV)
+	if err != nil {
+		return fmt.Errorf("Failed to open file %s: %w", opts.CSV, err)
+	}
+	defer func() {
+		if err := f.Close(); err != nil {
+			retErr = errors.Join(retErr, fmt.Errorf("Failed closing file %s: %w", opts.CSV, err))
+		}
+	}()
+	cr := csv.NewReader(f)
+	keys, err := cr.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return fmt.Errorf("%w: no header row", ErrInvalidCSV)
+		}
+		return fmt.Errorf("Failed reading csv %s: %w", opts.CSV, err)
+	}
+	for n, i := range keys {
+		keys[n] = strings.TrimSpace(i)
+	}
+	out, err := newSink(w, opts)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := out.close(); err != nil {
+			retErr = errors.Join(retErr, err)
+		}
+	}()
+	fopts := opts.Format
+	fopts.Template = false
+	fopts.Edit = false
+	if opts.Send.Addr != "" {
+		fopts.CRLF = true
+	}
+	var errs []error
+	for {
+		row, err := cr.Read()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			errs = append(errs, fmt.Errorf("Failed reading csv %s: %w", opts.CSV, err))
+			if errors.Is(err, csv.ErrFieldCount) {
+				continue
+			}
+			break
+		}
+		n, _ := cr.FieldPos(0)
+		if err := mergeRow(t, base, keys, row, n, fopts, out); err != nil {
+			errs = append(errs, fmt.Errorf("Failed to merge %s:%d: %w", opts.CSV, n, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func mergeRow(t *template.Template, base map[string]any, keys, row []string, n int, opts formatter.Opts, out sink) error {
+	data := make(map[string]any, len(base)+len(keys))
+	for k, v := range base {
+		data[k] = v
+	}
+	for i, k := range keys {
+		data[k] = row[i]
+	}
+	r, err := formatter.ExecTemplate(t, data)
+	if err != nil {
+		return err
+	}
+	// each row has its own generated values
+	opts.Seed += int64(n)
+	var b bytes.Buffer
+	if err := formatter.Format(r, &b, opts); err != nil {
+		return err
+	}
+	return out.put(n, b.Bytes())
+}
+
+func newSink(w io.Writer, opts Opts) (sink, error) {
+	if opts.Dir != "" {
+		if err := os.MkdirAll(opts.Dir, 0o777); err != nil {
+			return nil, fmt.Errorf("Failed to create dir %s: %w", opts.Dir, err)
+		}
+		return &dirSink{dir: opts.Dir}, nil
+	}
+	if opts.Mbox != "" {
+		f, err := os.OpenFile(opts.Mbox, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o666)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to open file %s: %w", opts.Mbox, err)
+		}
+		return &mboxSink{f: f, w: mbox.NewWriter(f), now: mboxTime(opts.Format)}, nil
+	}
+	if opts.Send.Addr != "" {
+		s := &sendSink{
+			sess:     send.NewSession(opts.Send.Addr, opts.Send.Username, opts.Send.Password),
+			from:     opts.Send.From,
+			to:       opts.Send.To,
+			selector: opts.Send.DKIMSelector,
+		}
+		if opts.Send.DKIMSelector != "" {
+			key, err := send.ReadDKIMKey(opts.Send.DKIMKeyFile)
+			if err != nil {
+				return nil, err
+			}
+			s.signer = key
+		}
+		return s, nil
+	}
+	return &mboxSink{w: mbox.NewWriter(w), now: mboxTime(opts.Format)}, nil
+}
+
+// mboxTime returns the time of mbox From lines, which is fixed for
+// deterministic output
+func mboxTime(opts formatter.Opts) func() time.Time {
+	if !opts.Deterministic {
+		return time.Now
+	}
+	now := opts.Now
+	if now.IsZero() {
+		now = time.Unix(0, 0).UTC()
+	}
+	return func() time.Time {
+		return now
+	}
+}
+
+func (s *dirSink) put(n int, msg []byte) error {
+	p := filepath.Join(s.dir, fmt.Sprintf(msgFileFmt, n))
+	if err := os.WriteFile(p, msg, 0o666); err != nil {
+		return fmt.Errorf("Failed writing file %s: %w", p, err)
+	}
+	return nil
+}
+
+func (s *dirSink) close() error {
+	return nil
+}
+
+func (s *mboxSink) put(n int, msg []byte) (retErr error) {
+	m := send.New()
+	if err := m.ReadMsg(bytes.NewReader(msg)); err != nil {
+		return err
+	}
+	from, _ := m.Envelope("", "")
+	w, err := s.w.Create(from, s.now())
+	if err != nil {
+		return fmt.Errorf("Failed creating mbox message: %w", err)
+	}
+	defer func() {
+		if err := w.Close(); err != nil {
+			retErr = errors.Join(retErr, fmt.Errorf("Failed closing mbox message: %w", err))
+		}
+	}()
+	if _, err := w.Write(msg); err != nil {
+		return fmt.Errorf("Failed writing mbox message: %w", err)
+	}
+	return nil
+}
+
+func (s *mboxSink) close() error {
+	if s.f == nil {
+		return nil
+	}
+	if err := s.f.Close(); err != nil {
+		return fmt.Errorf("Failed closing mbox: %w", err)
+	}
+	return nil
+}
+
+func (s *sendSink) put(n int, msg []byte) error {
+	m := send.New()
+	if err := m.ReadMsg(bytes.NewReader(msg)); err != nil {
+		return err
+	}
+	from, to := m.Envelope(s.from, s.to)
+	return s.sess.Deliver(from, to, func(w io.Writer) error {
+		return m.WriteMsg(w, s.selector, s.signer)
+	})
+}
+
+func (s *sendSink) close() error {
+	return s.sess.Close()
+}
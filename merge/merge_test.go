@@ -0,0 +1,83 @@
+package merge
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"xorkevin.dev/mailcat/formatter"
+)
+
+func Test_Merge(t *testing.T) {
+	t.Parallel()
+
+	tmpl := `From: a@example.com
+To: {{.name}} <{{.email}}>
+Subject: Hi {{.name}}
+
+Your code is {{.code}}.
+`
+
+	for _, tc := range []struct {
+		Name  string
+		CSV   string
+		Files []string
+		Err   error
+	}{
+		{
+			Name: "Line breaks in body fields",
+			CSV: `name,email,code
+Bob,bob@example.com,"12
+34"
+Ann,ann@example.com,56
+`,
+			Files: []string{"000002.eml", "000004.eml"},
+		},
+		{
+			Name: "Line breaks in header fields",
+			CSV: `name,email,code
+"Bob
+Bcc: evil@example.com",bob@example.com,12
+Ann,ann@example.com,56
+`,
+			Files: []string{"000004.eml"},
+			Err:   formatter.ErrInvalidHeader,
+		},
+	} {
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			assert := require.New(t)
+
+			dir := t.TempDir()
+			csvFile := filepath.Join(dir, "rows.csv")
+			assert.NoError(os.WriteFile(csvFile, []byte(tc.CSV), 0o666))
+			outDir := filepath.Join(dir, "out")
+			err := Merge(strings.NewReader(tmpl), nil, Opts{
+				CSV: csvFile,
+				Dir: outDir,
+				Format: formatter.Opts{
+					MsgIDDomain: "mail.example.com",
+				},
+			})
+			if tc.Err != nil {
+				assert.ErrorIs(err, tc.Err)
+			} else {
+				assert.NoError(err)
+			}
+			entries, err := os.ReadDir(outDir)
+			assert.NoError(err)
+			var files []string
+			for _, i := range entries {
+				files = append(files, i.Name())
+			}
+			assert.Equal(tc.Files, files)
+			for _, i := range files {
+				b, err := os.ReadFile(filepath.Join(outDir, i))
+				assert.NoError(err)
+				assert.NotContains(string(b), "evil@example.com")
+			}
+		})
+	}
+}
@@ -0,0 +1,165 @@
+package send
+
+import (
+	"bufio"
+	"crypto"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"xorkevin.dev/mailcat/mbox"
+)
+
+type (
+	batch struct {
+		deliver  deliverFunc
+		from     string
+		to       string
+		selector string
+		signer   crypto.Signer
+		errs     []error
+	}
+
+	deliverFunc func(from string, to []string, writeMsg func(w io.Writer) error) error
+)
+
+func newBatch(opts Opts) (*batch, error) {
+	b := &batch{
+		from:     opts.From,
+		to:       opts.To,
+		selector: opts.DKIMSelector,
+	}
+	if opts.DKIMSelector != "" {
+		key, err := ReadDKIMKey(opts.DKIMKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		b.signer = key
+	}
+	return b, nil
+}
+
+func (b *batch) run(paths []string) error {
+	for _, i := range paths {
+		if err := b.sendPath(i); err != nil {
+			b.errs = append(b.errs, err)
+		}
+	}
+	return errors.Join(b.errs...)
+}
+
+// SendBatch delivers every message from paths over a single smtp session.
+// Each path may be a message file, an mbox, or a directory of either.
+// Delivery continues past failed messages, and all failures are returned.
+func SendBatch(paths []string, opts Opts) (retErr error) {
+	if opts.Addr == "" {
+		return fmt.Errorf("%w: no address", ErrInvalidArgs)
+	}
+	if len(paths) == 0 {
+		return fmt.Errorf("%w: no messages", ErrInvalidArgs)
+	}
+	b, err := newBatch(opts)
+	if err != nil {
+		return err
+	}
+	sess := NewSession(opts.Addr, opts.Username, opts.Password)
+	defer func() {
+		if err := sess.Close(); err != nil {
+			retErr = errors.Join(retErr, err)
+		}
+	}()
+	b.deliver = sess.Deliver
+	return b.run(paths)
+}
+
+// DryRunBatch writes the smtp transaction of every message from paths to w
+// instead of connecting to a server
+func DryRunBatch(paths []string, w io.Writer, opts Opts) error {
+	if len(paths) == 0 {
+		return fmt.Errorf("%w: no messages", ErrInvalidArgs)
+	}
+	b, err := newBatch(opts)
+	if err != nil {
+		return err
+	}
+	b.deliver = func(from string, to []string, writeMsg func(w io.Writer) error) error {
+		return writeTransaction(w, from, to, writeMsg)
+	}
+	return b.run(paths)
+}
+
+func (b *batch) sendPath(p string) error {
+	info, err := os.Stat(p)
+	if err != nil {
+		return fmt.Errorf("Failed to stat %s: %w", p, err)
+	}
+	if !info.IsDir() {
+		return b.sendFile(p)
+	}
+	entries, err := os.ReadDir(p)
+	if err != nil {
+		return fmt.Errorf("Failed to read dir %s: %w", p, err)
+	}
+	for _, i := range entries {
+		if !i.Type().IsRegular() || strings.HasPrefix(i.Name(), ".") {
+			continue
+		}
+		if err := b.sendFile(filepath.Join(p, i.Name())); err != nil {
+			b.errs = append(b.errs, err)
+		}
+	}
+	return nil
+}
+
+func (b *batch) sendFile(p string) (retErr error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return fmt.Errorf("Failed to open file %s: %w", p, err)
+	}
+	defer func() {
+		if err := f.Close(); err != nil {
+			retErr = errors.Join(retErr, fmt.Errorf("Failed closing file %s: %w", p, err))
+		}
+	}()
+	r := bufio.NewReader(f)
+	prefix, err := r.Peek(len("From "))
+	if err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("Failed reading file %s: %w", p, err)
+	}
+	if !mbox.IsMbox(prefix) {
+		if err := b.sendMsg(r); err != nil {
+			return fmt.Errorf("Failed to send %s: %w", p, err)
+		}
+		return nil
+	}
+	mr := mbox.NewReader(r)
+	for n := 1; ; n++ {
+		m, err := mr.Next()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return fmt.Errorf("Failed reading mbox %s: %w", p, err)
+		}
+		if err := b.sendMsg(m); err != nil {
+			b.errs = append(b.errs, fmt.Errorf("Failed to send %s:%d: %w", p, n, err))
+		}
+	}
+}
+
+func (b *batch) sendMsg(r io.Reader) error {
+	s := &sender{}
+	if err := s.ReadMsg(r); err != nil {
+		return err
+	}
+	from, to := s.Envelope(b.from, b.to)
+	if err := b.deliver(from, to, func(w io.Writer) error {
+		return s.WriteMsg(w, b.selector, b.signer)
+	}); err != nil {
+		return err
+	}
+	return nil
+}
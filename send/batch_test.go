@@ -0,0 +1,95 @@
+package send
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type (
+	testDelivery struct {
+		from string
+		to   []string
+		msg  string
+	}
+)
+
+func testMsg(msgid, subject string) string {
+	return "From: alice@example.com\nTo: bob@example.com\nCc: carol@example.com\nSubject: " + subject + "\nMessage-ID: <" + msgid + ">\n\nhello\n"
+}
+
+func Test_Batch(t *testing.T) {
+	t.Parallel()
+
+	assert := require.New(t)
+
+	dir := t.TempDir()
+	assert.NoError(os.WriteFile(filepath.Join(dir, "a.eml"), []byte(testMsg("m1@example.com", "one")), 0o644))
+	assert.NoError(os.WriteFile(filepath.Join(dir, "b.mbox"), []byte(
+		"From alice@example.com Mon Jan  2 15:04:05 2006\n"+testMsg("m2@example.com", "two")+
+			"\nFrom alice@example.com Mon Jan  2 15:04:05 2006\n"+testMsg("m3@example.com", "")+
+			"\nFrom alice@example.com Mon Jan  2 15:04:05 2006\n"+testMsg("m4@example.com", "four"),
+	), 0o644))
+	assert.NoError(os.WriteFile(filepath.Join(dir, ".hidden.eml"), []byte(testMsg("m5@example.com", "hidden")), 0o644))
+	assert.NoError(os.Mkdir(filepath.Join(dir, "sub"), 0o755))
+	single := filepath.Join(t.TempDir(), "single.eml")
+	assert.NoError(os.WriteFile(single, []byte(testMsg("m6@example.com", "six")), 0o644))
+
+	for _, tc := range []struct {
+		Name string
+		Opts Opts
+		From string
+		To   []string
+	}{
+		{
+			Name: "Envelope from message headers",
+			From: "alice@example.com",
+			To:   []string{"bob@example.com", "carol@example.com"},
+		},
+		{
+			Name: "Envelope from options",
+			Opts: Opts{
+				From: "bounce@example.com",
+				To:   "dave@example.com",
+			},
+			From: "bounce@example.com",
+			To:   []string{"dave@example.com"},
+		},
+	} {
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			assert := require.New(t)
+
+			b, err := newBatch(tc.Opts)
+			assert.NoError(err)
+			var deliveries []testDelivery
+			b.deliver = func(from string, to []string, writeMsg func(w io.Writer) error) error {
+				var msg bytes.Buffer
+				if err := writeMsg(&msg); err != nil {
+					return err
+				}
+				deliveries = append(deliveries, testDelivery{
+					from: from,
+					to:   to,
+					msg:  msg.String(),
+				})
+				return nil
+			}
+			err = b.run([]string{dir, filepath.Join(dir, "missing.eml"), single})
+			// delivery continues past failures, which are all returned
+			assert.ErrorIs(err, ErrInvalidHeader)
+			assert.ErrorContains(err, "b.mbox:2")
+			assert.ErrorIs(err, os.ErrNotExist)
+			assert.Len(deliveries, 4)
+			for n, i := range []string{"one", "two", "four", "six"} {
+				assert.Equal(tc.From, deliveries[n].from)
+				assert.Equal(tc.To, deliveries[n].to)
+				assert.Contains(deliveries[n].msg, "Subject: "+i+"\r\n")
+			}
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package send
+
+import (
+	"bufio"
+	"crypto"
+	"fmt"
+	"io"
+	"net/textproto"
+)
+
+// DryRun validates and dkim signs a message read from r, and writes the smtp
+// transaction that would be sent to w instead of connecting to a server. As
+// with [Send], the smtp from and to are required.
+func DryRun(r io.Reader, w io.Writer, opts Opts) error {
+	if opts.From == "" {
+		return fmt.Errorf("%w: no smtp from", ErrInvalidArgs)
+	}
+	if opts.To == "" {
+		return fmt.Errorf("%w: no smtp to", ErrInvalidArgs)
+	}
+	s := New()
+	if err := s.ReadMsg(r); err != nil {
+		return err
+	}
+	var signer crypto.Signer
+	if opts.DKIMSelector != "" {
+		key, err := ReadDKIMKey(opts.DKIMKeyFile)
+		if err != nil {
+			return err
+		}
+		signer = key
+	}
+	return writeTransaction(w, opts.From, []string{opts.To}, func(w io.Writer) error {
+		return s.WriteMsg(w, opts.DKIMSelector, signer)
+	})
+}
+
+// writeTransaction writes the envelope and dot-stuffed message data exactly
+// as they would be sent in an smtp mail transaction
+func writeTransaction(w io.Writer, from string, to []string, writeMsg func(w io.Writer) error) error {
+	tw := textproto.NewWriter(bufio.NewWriter(w))
+	if err := tw.PrintfLine("MAIL FROM:<%s>", from); err != nil {
+		return fmt.Errorf("Failed to write envelope: %w", err)
+	}
+	for _, i := range to {
+		if err := tw.PrintfLine("RCPT TO:<%s>", i); err != nil {
+			return fmt.Errorf("Failed to write envelope: %w", err)
+		}
+	}
+	if err := tw.PrintfLine("DATA"); err != nil {
+		return fmt.Errorf("Failed to write envelope: %w", err)
+	}
+	dw := tw.DotWriter()
+	if err := writeMsg(dw); err != nil {
+		return err
+	}
+	if err := dw.Close(); err != nil {
+		return fmt.Errorf("Failed to write mail message: %w", err)
+	}
+	if err := tw.W.Flush(); err != nil {
+		return fmt.Errorf("Failed to write mail message: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package send
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_DryRun(t *testing.T) {
+	t.Parallel()
+
+	inp := "From: alice@example.com\nTo: bob@example.com\nSubject: lunch\nMessage-ID: <m1@example.com>\n\nhello\n.leading dot\n"
+
+	for _, tc := range []struct {
+		Name string
+		Opts Opts
+		Exp  string
+		Err  error
+	}{
+		{
+			Name: "Writes the envelope and dot-stuffed data",
+			Opts: Opts{
+				From: "bounce@example.com",
+				To:   "carol@example.com",
+			},
+			Exp: "MAIL FROM:<bounce@example.com>\r\nRCPT TO:<carol@example.com>\r\nDATA\r\n" +
+				"Mime-Version: 1.0\r\nFrom: alice@example.com\r\nTo: bob@example.com\r\nSubject: lunch\r\nMessage-ID: <m1@example.com>\r\n\r\nhello\r\n..leading dot\r\n.\r\n",
+		},
+		{
+			Name: "Requires smtp from",
+			Opts: Opts{
+				To: "carol@example.com",
+			},
+			Err: ErrInvalidArgs,
+		},
+		{
+			Name: "Requires smtp to",
+			Opts: Opts{
+				From: "bounce@example.com",
+			},
+			Err: ErrInvalidArgs,
+		},
+	} {
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			assert := require.New(t)
+
+			var b bytes.Buffer
+			err := DryRun(strings.NewReader(inp), &b, tc.Opts)
+			if tc.Err != nil {
+				assert.ErrorIs(err, tc.Err)
+				assert.Zero(b.Len())
+				return
+			}
+			assert.NoError(err)
+			assert.Equal(tc.Exp, b.String())
+		})
+	}
+}
+
+func Test_DryRunBatch(t *testing.T) {
+	t.Parallel()
+
+	assert := require.New(t)
+
+	dir := t.TempDir()
+	assert.NoError(os.WriteFile(filepath.Join(dir, "a.eml"), []byte(testMsg("m1@example.com", "one")), 0o644))
+	assert.NoError(os.WriteFile(filepath.Join(dir, "b.eml"), []byte(testMsg("m2@example.com", "two")), 0o644))
+
+	var b bytes.Buffer
+	assert.NoError(DryRunBatch([]string{dir}, &b, Opts{}))
+	out := b.String()
+	// each message is its own transaction with the envelope from its headers
+	assert.Equal(2, strings.Count(out, "MAIL FROM:<alice@example.com>\r\nRCPT TO:<bob@example.com>\r\nRCPT TO:<carol@example.com>\r\nDATA\r\n"))
+	assert.Equal(2, strings.Count(out, "\r\n.\r\n"))
+	assert.Less(strings.Index(out, "Subject: one\r\n"), strings.Index(out, "Subject: two\r\n"))
+}
@@ -17,8 +17,6 @@ import (
 	_ "github.com/emersion/go-message/charset"
 	emmail "github.com/emersion/go-message/mail"
 	"github.com/emersion/go-msgauth/dkim"
-	"github.com/emersion/go-sasl"
-	"github.com/emersion/go-smtp"
 	"golang.org/x/text/transform"
 	"xorkevin.dev/mailcat/transformer"
 )
@@ -36,6 +34,9 @@ type (
 
 	Sender interface {
 		ReadMsg(r io.Reader) error
+		MsgID() string
+		Envelope(from, to string) (string, []string)
+		WriteMsg(w io.Writer, dkimSelector string, dkimKey crypto.Signer) error
 		Send(addr string, username, password string, from, to string, dkimSelector string, dkimKeyFile string) error
 	}
 
@@ -43,6 +44,8 @@ type (
 		m              *message.Entity
 		fromAddr       string
 		fromAddrDomain string
+		msgid          string
+		rcpts          []string
 		headers        []string
 	}
 )
@@ -80,6 +83,10 @@ const (
 	headerContentType = "Content-Type"
 	headerMsgID       = "Message-ID"
 	headerDate        = "Date"
+
+	headerListID              = "List-Id"
+	headerListUnsubscribe     = "List-Unsubscribe"
+	headerListUnsubscribePost = "List-Unsubscribe-Post"
 )
 
 func (s *sender) ReadMsg(r io.Reader) error {
@@ -95,6 +102,8 @@ func (s *sender) ReadMsg(r io.Reader) error {
 		return fmt.Errorf("Invalid Message-ID: %w", err)
 	} else if msgid == "" {
 		return fmt.Errorf("%w: no Message-ID", ErrInvalidHeader)
+	} else {
+		s.msgid = msgid
 	}
 	s.headers = make([]string, 0, 10)
 	s.headers = append(s.headers, headerMsgID)
@@ -121,10 +130,13 @@ func (s *sender) ReadMsg(r io.Reader) error {
 		s.fromAddrDomain = fromAddrDomain
 	}
 	s.headers = append(s.headers, headerFrom)
+	s.rcpts = nil
 	if addrs, err := headers.AddressList(headerTo); err != nil {
 		return fmt.Errorf("Invalid To: %w", err)
 	} else if len(addrs) == 0 {
 		return fmt.Errorf("%w: no To", ErrInvalidHeader)
+	} else {
+		s.addRcpts(addrs)
 	}
 	s.headers = append(s.headers, headerTo)
 	if headers.Has(headerCc) {
@@ -132,12 +144,16 @@ func (s *sender) ReadMsg(r io.Reader) error {
 			return fmt.Errorf("Invalid Cc: %w", err)
 		} else if len(addrs) == 0 {
 			return fmt.Errorf("%w: empty Cc", ErrInvalidHeader)
+		} else {
+			s.addRcpts(addrs)
 		}
 		s.headers = append(s.headers, headerCc)
 	}
 	if headers.Has(headerBcc) {
-		if _, err := headers.AddressList(headerBcc); err != nil {
+		if addrs, err := headers.AddressList(headerBcc); err != nil {
 			return fmt.Errorf("Invalid Bcc: %w", err)
+		} else {
+			s.addRcpts(addrs)
 		}
 		headers.Del(headerBcc)
 	}
@@ -181,16 +197,38 @@ func (s *sender) ReadMsg(r io.Reader) error {
 		}
 		s.headers = append(s.headers, headerContentType)
 	}
+	if headers.Has(headerListUnsubscribePost) && !headers.Has(headerListUnsubscribe) {
+		return fmt.Errorf("%w: List-Unsubscribe-Post without List-Unsubscribe", ErrInvalidHeader)
+	}
+	// list headers are signed since providers require a signature covering
+	// them for one click unsubscribe
+	for _, i := range []string{headerListID, headerListUnsubscribe, headerListUnsubscribePost} {
+		if headers.Has(i) {
+			s.headers = append(s.headers, i)
+		}
+	}
+	m.Header = headers.Header
 	s.m = m
 	return nil
 }
 
+// MsgID returns the Message-ID of the message without angle brackets
+func (s *sender) MsgID() string {
+	return s.msgid
+}
+
+func (s *sender) addRcpts(addrs []*emmail.Address) {
+	for _, i := range addrs {
+		s.rcpts = append(s.rcpts, i.Address)
+	}
+}
+
 const (
 	durationMonth = 30 * 24 * time.Hour
 )
 
-func (s *sender) sign(w io.Writer, r io.Reader, selector string, signer crypto.Signer) error {
-	if err := dkim.Sign(w, r, &dkim.SignOptions{
+func (s *sender) signOpts(selector string, signer crypto.Signer) *dkim.SignOptions {
+	return &dkim.SignOptions{
 		Domain:                 s.fromAddrDomain,
 		Selector:               selector,
 		Identifier:             s.fromAddr,
@@ -201,9 +239,61 @@ func (s *sender) sign(w io.Writer, r io.Reader, selector string, signer crypto.S
 		HeaderKeys:             s.headers,
 		Expiration:             time.Now().Round(0).Add(durationMonth),
 		QueryMethods:           []dkim.QueryMethod{dkim.QueryMethodDNSTXT},
-	}); err != nil {
+	}
+}
+
+const (
+	spoolFilePattern = "mailcat-spool-*"
+)
+
+// WriteMsg streams the message to w, spooling the message to a temporary file
+// when dkim signing requires a second pass over the message
+func (s *sender) WriteMsg(w io.Writer, selector string, signer crypto.Signer) (retErr error) {
+	if s.m == nil {
+		return ErrNoMsg
+	}
+	if signer == nil {
+		if err := s.m.WriteTo(w); err != nil {
+			return fmt.Errorf("Failed to write mail message: %w", err)
+		}
+		return nil
+	}
+	ds, err := dkim.NewSigner(s.signOpts(selector, signer))
+	if err != nil {
+		return fmt.Errorf("Failed to create dkim signer: %w", err)
+	}
+	defer func() {
+		// release the signing goroutine on early return; the close error is
+		// checked below on success
+		_ = ds.Close()
+	}()
+	f, err := os.CreateTemp("", spoolFilePattern)
+	if err != nil {
+		return fmt.Errorf("Failed to create spool file: %w", err)
+	}
+	defer func() {
+		if err := f.Close(); err != nil {
+			retErr = errors.Join(retErr, fmt.Errorf("Failed closing spool file %s: %w", f.Name(), err))
+		}
+		if err := os.Remove(f.Name()); err != nil {
+			retErr = errors.Join(retErr, fmt.Errorf("Failed removing spool file %s: %w", f.Name(), err))
+		}
+	}()
+	if err := s.m.WriteTo(io.MultiWriter(f, ds)); err != nil {
+		return fmt.Errorf("Failed to write mail message: %w", err)
+	}
+	if err := ds.Close(); err != nil {
 		return fmt.Errorf("Failed to dkim sign message: %w", err)
 	}
+	if _, err := io.WriteString(w, ds.Signature()); err != nil {
+		return fmt.Errorf("Failed to write mail message: %w", err)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("Failed to seek spool file %s: %w", f.Name(), err)
+	}
+	if _, err := io.Copy(w, f); err != nil {
+		return fmt.Errorf("Failed to write mail message: %w", err)
+	}
 	return nil
 }
 
@@ -211,7 +301,59 @@ const (
 	pemBlockType = "PRIVATE KEY"
 )
 
-func (s *sender) Send(addr string, username, password string, from, to string, dkimSelector string, dkimKeyFile string) error {
+// ReadDKIMKey reads a PKCS8 rsa private key from a PEM file
+func ReadDKIMKey(dkimKeyFile string) (*rsa.PrivateKey, error) {
+	var k bytes.Buffer
+	if err := func() (retErr error) {
+		f, err := os.Open(dkimKeyFile)
+		if err != nil {
+			return fmt.Errorf("Failed to open file %s: %w", dkimKeyFile, err)
+		}
+		defer func() {
+			if err := f.Close(); err != nil {
+				retErr = errors.Join(retErr, fmt.Errorf("Failed closing file %s: %w", dkimKeyFile, err))
+			}
+		}()
+		if _, err := io.Copy(&k, f); err != nil {
+			return fmt.Errorf("Failed reading file %s: %w", dkimKeyFile, err)
+		}
+		return nil
+	}(); err != nil {
+		return nil, err
+	}
+	pemBlock, _ := pem.Decode(k.Bytes())
+	if pemBlock == nil {
+		return nil, fmt.Errorf("Invalid rsakey pem file %s", dkimKeyFile)
+	}
+	if pemBlock.Type != pemBlockType {
+		return nil, fmt.Errorf("Invalid rsakey pem file %s of type %s", dkimKeyFile, pemBlock.Type)
+	}
+	rawKey, err := x509.ParsePKCS8PrivateKey(pemBlock.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid rsakey pkcs8 of pem file %s: %w", dkimKeyFile, err)
+	}
+	key, ok := rawKey.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%w: Key of pem file %s is not rsa", ErrInvalidArgs, dkimKeyFile)
+	}
+	key.Precompute()
+	return key, nil
+}
+
+// Envelope returns the smtp envelope, defaulting to the message headers. The
+// defaults are for sending many messages, since Send of a single message
+// requires an explicit envelope.
+func (s *sender) Envelope(from, to string) (string, []string) {
+	if from == "" {
+		from = s.fromAddr
+	}
+	if to != "" {
+		return from, []string{to}
+	}
+	return from, s.rcpts
+}
+
+func (s *sender) Send(addr string, username, password string, from, to string, dkimSelector string, dkimKeyFile string) (retErr error) {
 	if s.m == nil {
 		return ErrNoMsg
 	}
@@ -224,53 +366,23 @@ func (s *sender) Send(addr string, username, password string, from, to string, d
 	if to == "" {
 		return fmt.Errorf("%w: no smtp to", ErrInvalidArgs)
 	}
-	var b bytes.Buffer
-	if err := s.m.WriteTo(&b); err != nil {
-		return fmt.Errorf("Failed to write mail message: %w", err)
-	}
+	var signer crypto.Signer
 	if dkimSelector != "" {
-		var k bytes.Buffer
-		if err := func() (retErr error) {
-			f, err := os.Open(dkimKeyFile)
-			if err != nil {
-				return fmt.Errorf("Failed to open file %s: %w", dkimKeyFile, err)
-			}
-			defer func() {
-				if err := f.Close(); err != nil {
-					retErr = errors.Join(retErr, fmt.Errorf("Failed closing file %s: %w", dkimKeyFile, err))
-				}
-			}()
-			if _, err := io.Copy(&k, f); err != nil {
-				return fmt.Errorf("Failed reading file %s: %w", dkimKeyFile, err)
-			}
-			return nil
-		}(); err != nil {
-			return err
-		}
-		pemBlock, _ := pem.Decode(k.Bytes())
-		if pemBlock == nil || pemBlock.Type != pemBlockType {
-			return fmt.Errorf("Invalid rsakey pem file %s of type %s", dkimKeyFile, pemBlock.Type)
-		}
-		rawKey, err := x509.ParsePKCS8PrivateKey(pemBlock.Bytes)
+		key, err := ReadDKIMKey(dkimKeyFile)
 		if err != nil {
-			return fmt.Errorf("Invalid rsakey pkcs8 of pem file %s: %w", dkimKeyFile, err)
-		}
-		key, ok := rawKey.(*rsa.PrivateKey)
-		if !ok {
-			return fmt.Errorf("%w: Key of pem file %s is not rsa", ErrInvalidArgs, dkimKeyFile)
-		}
-		key.Precompute()
-		var t bytes.Buffer
-		if err := s.sign(&t, &b, dkimSelector, key); err != nil {
 			return err
 		}
-		b = t
-	}
-	var auth sasl.Client
-	if username != "" {
-		auth = sasl.NewPlainClient("", username, password)
+		signer = key
 	}
-	if err := smtp.SendMail(addr, auth, from, []string{to}, &b); err != nil {
+	sess := NewSession(addr, username, password)
+	defer func() {
+		if err := sess.Close(); err != nil {
+			retErr = errors.Join(retErr, err)
+		}
+	}()
+	if err := sess.Deliver(from, []string{to}, func(w io.Writer) error {
+		return s.WriteMsg(w, dkimSelector, signer)
+	}); err != nil {
 		return fmt.Errorf("Failed to send mail: %w", err)
 	}
 	return nil
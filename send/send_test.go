@@ -0,0 +1,53 @@
+package send
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/emersion/go-msgauth/dkim"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_WriteMsg_DKIM(t *testing.T) {
+	t.Parallel()
+
+	assert := require.New(t)
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(err)
+	pub, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	assert.NoError(err)
+	lookupTXT := func(domain string) ([]string, error) {
+		assert.Equal("mail._domainkey.example.com", domain)
+		return []string{"v=DKIM1; k=rsa; p=" + base64.StdEncoding.EncodeToString(pub)}, nil
+	}
+
+	s := New()
+	assert.NoError(s.ReadMsg(strings.NewReader("From: alice@example.com\r\nTo: bob@example.com\r\nSubject: lunch\r\nMessage-ID: <m1@example.com>\r\n\r\nhello\r\n")))
+	var b bytes.Buffer
+	assert.NoError(s.WriteMsg(&b, "mail", key))
+	msg := b.String()
+	assert.True(strings.HasPrefix(msg, "DKIM-Signature: "))
+
+	verifs, err := dkim.VerifyWithOptions(strings.NewReader(msg), &dkim.VerifyOptions{
+		LookupTXT: lookupTXT,
+	})
+	assert.NoError(err)
+	assert.Len(verifs, 1)
+	assert.NoError(verifs[0].Err)
+	assert.Equal("example.com", verifs[0].Domain)
+	assert.Equal("alice@example.com", verifs[0].Identifier)
+
+	// the signature covers the spooled body
+	verifs, err = dkim.VerifyWithOptions(strings.NewReader(strings.Replace(msg, "hello", "howdy", 1)), &dkim.VerifyOptions{
+		LookupTXT: lookupTXT,
+	})
+	assert.NoError(err)
+	assert.Len(verifs, 1)
+	assert.Error(verifs[0].Err)
+}
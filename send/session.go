@@ -0,0 +1,223 @@
+package send
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	"github.com/emersion/go-sasl"
+	"github.com/emersion/go-smtp"
+)
+
+type (
+	// Session is an authenticated smtp session that may be reused to deliver
+	// many messages
+	Session struct {
+		addr  string
+		auth  sasl.Client
+		trace TraceFunc
+		c     *smtp.Client
+		dirty bool
+	}
+
+	// Stage is an smtp session stage
+	Stage string
+
+	// TraceFunc receives the duration and result of an smtp stage
+	TraceFunc func(stage Stage, d time.Duration, err error)
+)
+
+const (
+	StageConnect Stage = "connect"
+	StageHello   Stage = "hello"
+	StageTLS     Stage = "starttls"
+	StageAuth    Stage = "auth"
+	StageMail    Stage = "mail"
+	StageRcpt    Stage = "rcpt"
+	StageData    Stage = "data"
+	StageReset   Stage = "reset"
+)
+
+const (
+	localName = "localhost"
+)
+
+// NewSession creates a new session. The connection is established lazily on
+// the first delivery.
+func NewSession(addr string, username, password string) *Session {
+	var auth sasl.Client
+	if username != "" {
+		auth = sasl.NewPlainClient("", username, password)
+	}
+	return &Session{
+		addr: addr,
+		auth: auth,
+	}
+}
+
+// SetTrace sets a function that is called with the duration and result of
+// each smtp stage of the session
+func (s *Session) SetTrace(trace TraceFunc) {
+	s.trace = trace
+}
+
+// stage runs and traces an smtp stage
+func (s *Session) stage(stage Stage, fn func() error) error {
+	if s.trace == nil {
+		return fn()
+	}
+	start := time.Now()
+	err := fn()
+	s.trace(stage, time.Since(start), err)
+	return err
+}
+
+// dial connects to an smtp server, requiring STARTTLS, and authenticates if
+// auth is provided
+func (s *Session) dial() (_ *smtp.Client, retErr error) {
+	var c *smtp.Client
+	if err := s.stage(StageConnect, func() error {
+		var err error
+		c, err = smtp.Dial(s.addr)
+		return err
+	}); err != nil {
+		return nil, fmt.Errorf("Failed to connect to smtp server %s: %w", s.addr, err)
+	}
+	defer func() {
+		if retErr != nil {
+			if err := c.Close(); err != nil {
+				retErr = errors.Join(retErr, fmt.Errorf("Failed closing smtp connection: %w", err))
+			}
+		}
+	}()
+	if err := s.stage(StageHello, func() error {
+		return c.Hello(localName)
+	}); err != nil {
+		return nil, fmt.Errorf("Failed to greet smtp server %s: %w", s.addr, err)
+	}
+	if ok, _ := c.Extension("STARTTLS"); !ok {
+		return nil, fmt.Errorf("Smtp server %s does not support STARTTLS", s.addr)
+	}
+	if err := s.stage(StageTLS, func() error {
+		return c.StartTLS(nil)
+	}); err != nil {
+		return nil, fmt.Errorf("Failed to start tls: %w", err)
+	}
+	if s.auth != nil {
+		if ok, _ := c.Extension("AUTH"); !ok {
+			return nil, fmt.Errorf("Smtp server %s does not support AUTH", s.addr)
+		}
+		if err := s.stage(StageAuth, func() error {
+			return c.Auth(s.auth)
+		}); err != nil {
+			return nil, fmt.Errorf("Failed to authenticate: %w", err)
+		}
+	}
+	return c, nil
+}
+
+// conn returns a connection ready for a new mail transaction, resetting a
+// previously used connection and reconnecting if it has failed
+func (s *Session) conn() (*smtp.Client, error) {
+	if s.c != nil && s.dirty {
+		if err := s.stage(StageReset, s.c.Reset); err != nil {
+			s.drop()
+		} else {
+			s.dirty = false
+		}
+	}
+	if s.c == nil {
+		c, err := s.dial()
+		if err != nil {
+			return nil, err
+		}
+		s.c = c
+		s.dirty = false
+	}
+	return s.c, nil
+}
+
+// drop closes a failed connection so that the next delivery reconnects
+func (s *Session) drop() {
+	if s.c == nil {
+		return
+	}
+	// the connection has already failed, so there is nothing more to report
+	_ = s.c.Close()
+	s.c = nil
+	s.dirty = false
+}
+
+// Deliver sends a message over the session. The message is written by
+// writeMsg to the smtp DATA stream.
+func (s *Session) Deliver(from string, to []string, writeMsg func(w io.Writer) error) error {
+	c, err := s.conn()
+	if err != nil {
+		return err
+	}
+	s.dirty = true
+	if err := s.deliver(c, from, to, writeMsg); err != nil {
+		var smtpErr *smtp.SMTPError
+		if !errors.As(err, &smtpErr) {
+			// the connection is in an unknown state after a non-protocol error
+			s.drop()
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *Session) deliver(c *smtp.Client, from string, to []string, writeMsg func(w io.Writer) error) error {
+	if err := s.stage(StageMail, func() error {
+		return c.Mail(from, nil)
+	}); err != nil {
+		return fmt.Errorf("Failed to send mail from %s: %w", from, err)
+	}
+	for _, i := range to {
+		if err := s.stage(StageRcpt, func() error {
+			return c.Rcpt(i)
+		}); err != nil {
+			return fmt.Errorf("Failed to send mail to %s: %w", i, err)
+		}
+	}
+	var writeErr error
+	if err := s.stage(StageData, func() error {
+		w, err := c.Data()
+		if err != nil {
+			return err
+		}
+		if err := writeMsg(w); err != nil {
+			writeErr = err
+			return err
+		}
+		return w.Close()
+	}); err != nil {
+		if writeErr != nil {
+			// closing the data writer would end the DATA section and commit
+			// the truncated message, so the connection is closed instead to
+			// abort the transaction
+			s.drop()
+			return writeErr
+		}
+		return fmt.Errorf("Failed to send mail data: %w", err)
+	}
+	return nil
+}
+
+// Close ends the session
+func (s *Session) Close() error {
+	if s.c == nil {
+		return nil
+	}
+	c := s.c
+	s.c = nil
+	if err := c.Quit(); err != nil {
+		if cerr := c.Close(); cerr != nil && !errors.Is(cerr, net.ErrClosed) {
+			err = errors.Join(err, fmt.Errorf("Failed closing smtp connection: %w", cerr))
+		}
+		return fmt.Errorf("Failed to quit smtp session: %w", err)
+	}
+	return nil
+}
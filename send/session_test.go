@@ -0,0 +1,114 @@
+package send
+
+import (
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-smtp"
+	"github.com/stretchr/testify/require"
+)
+
+type (
+	testBackend struct {
+		data chan testData
+	}
+
+	testSession struct {
+		data chan testData
+	}
+
+	testData struct {
+		msg string
+		err error
+	}
+)
+
+func (b *testBackend) NewSession(c *smtp.Conn) (smtp.Session, error) {
+	return &testSession{data: b.data}, nil
+}
+
+func (s *testSession) Reset()                                         {}
+func (s *testSession) Logout() error                                  { return nil }
+func (s *testSession) AuthPlain(username, password string) error      { return nil }
+func (s *testSession) Mail(from string, opts *smtp.MailOptions) error { return nil }
+func (s *testSession) Rcpt(to string) error                           { return nil }
+
+func (s *testSession) Data(r io.Reader) error {
+	b, err := io.ReadAll(r)
+	s.data <- testData{msg: string(b), err: err}
+	return err
+}
+
+func Test_Session_Deliver(t *testing.T) {
+	t.Parallel()
+
+	errWrite := errors.New("write failed")
+
+	for _, tc := range []struct {
+		Name     string
+		Body     string
+		WriteErr error
+		Msg      string
+	}{
+		{
+			Name: "Delivers message",
+			Body: "Subject: hi\r\n\r\nhello\r\n",
+			Msg:  "Subject: hi\r\n\r\nhello\r\n",
+		},
+		{
+			Name:     "Aborts transaction on write error",
+			Body:     "Subject: hi\r\n\r\ntrunc",
+			WriteErr: errWrite,
+		},
+	} {
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			assert := require.New(t)
+
+			be := &testBackend{data: make(chan testData, 1)}
+			srv := smtp.NewServer(be)
+			srv.Domain = "localhost"
+			l, err := net.Listen("tcp", "127.0.0.1:0")
+			assert.NoError(err)
+			go func() {
+				_ = srv.Serve(l)
+			}()
+			t.Cleanup(func() {
+				_ = srv.Close()
+			})
+
+			c, err := smtp.Dial(l.Addr().String())
+			assert.NoError(err)
+			assert.NoError(c.Hello(localName))
+			s := &Session{c: c}
+
+			err = s.Deliver("a@example.com", []string{"b@example.com"}, func(w io.Writer) error {
+				if _, err := io.Copy(w, strings.NewReader(tc.Body)); err != nil {
+					return err
+				}
+				return tc.WriteErr
+			})
+
+			var d testData
+			select {
+			case d = <-be.data:
+			case <-time.After(5 * time.Second):
+				assert.FailNow("Timed out waiting for message data")
+			}
+			if tc.WriteErr != nil {
+				assert.ErrorIs(err, tc.WriteErr)
+				assert.Nil(s.c)
+				assert.Error(d.err)
+				return
+			}
+			assert.NoError(err)
+			assert.NoError(d.err)
+			assert.Equal(tc.Msg, d.msg)
+			assert.NoError(s.Close())
+		})
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/base32"
 	"encoding/binary"
 	"fmt"
+	"io"
 	"strings"
 	"time"
 )
@@ -22,12 +23,17 @@ const (
 
 // NewSnowflake creates a new snowflake uid
 func NewSnowflake(randsize int) (*Snowflake, error) {
+	return NewSnowflakeFrom(time.Now(), rand.Reader, randsize)
+}
+
+// NewSnowflakeFrom creates a new snowflake uid at time t with random bytes
+// read from r
+func NewSnowflakeFrom(t time.Time, r io.Reader, randsize int) (*Snowflake, error) {
 	u := make([]byte, timeSize+randsize)
-	now := uint64(time.Now().Round(0).UnixMilli())
+	now := uint64(t.Round(0).UnixMilli())
 	binary.BigEndian.PutUint64(u[:timeSize], now)
-	_, err := rand.Read(u[timeSize:])
-	if err != nil {
-		return nil, fmt.Errorf("Failed reading crypto/rand: %w", err)
+	if _, err := io.ReadFull(r, u[timeSize:]); err != nil {
+		return nil, fmt.Errorf("Failed reading random bytes: %w", err)
 	}
 	return &Snowflake{
 		u: u,
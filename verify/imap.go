@@ -0,0 +1,172 @@
+package verify
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/client"
+	"github.com/emersion/go-imap/commands"
+)
+
+type (
+	imapMailbox struct {
+		c         *client.Client
+		mailboxes []imapMailboxInfo
+	}
+
+	// imapExpungeCmd is an EXPUNGE of specific messages, which must be sent as
+	// a UID EXPUNGE of RFC 4315
+	imapExpungeCmd struct {
+		seqset *imap.SeqSet
+	}
+
+	imapMailboxInfo struct {
+		name string
+		spam bool
+	}
+)
+
+const (
+	imapInbox   = "INBOX"
+	imapUIDPlus = "UIDPLUS"
+)
+
+var (
+	spamMailboxNames = []string{"spam", "junk", "bulk"}
+)
+
+func isSpamMailbox(info *imap.MailboxInfo) bool {
+	if slices.Contains(info.Attributes, imap.JunkAttr) {
+		return true
+	}
+	name := strings.ToLower(info.Name)
+	for _, i := range spamMailboxNames {
+		if strings.Contains(name, i) {
+			return true
+		}
+	}
+	return false
+}
+
+func (cmd *imapExpungeCmd) Command() *imap.Command {
+	return &imap.Command{
+		Name:      "EXPUNGE",
+		Arguments: []interface{}{cmd.seqset},
+	}
+}
+
+// dialIMAP connects to an imap server over tls. If no mailboxes are
+// specified, the inbox and any spam mailboxes are searched. The timeout
+// bounds connecting and each command.
+func dialIMAP(addr string, username, password string, mailboxes []string, timeout time.Duration) (_ *imapMailbox, retErr error) {
+	c, err := client.DialWithDialerTLS(&net.Dialer{Timeout: timeout}, addr, nil)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to connect to imap server %s: %w", addr, err)
+	}
+	c.Timeout = timeout
+	defer func() {
+		if retErr != nil {
+			if err := c.Logout(); err != nil {
+				retErr = errors.Join(retErr, fmt.Errorf("Failed to logout of imap server: %w", err))
+			}
+		}
+	}()
+	if err := c.Login(username, password); err != nil {
+		return nil, fmt.Errorf("Failed to login to imap server: %w", err)
+	}
+	ch := make(chan *imap.MailboxInfo, 16)
+	done := make(chan error, 1)
+	go func() {
+		done <- c.List("", "*", ch)
+	}()
+	var infos []imapMailboxInfo
+	for i := range ch {
+		if slices.Contains(i.Attributes, imap.NoSelectAttr) {
+			continue
+		}
+		spam := isSpamMailbox(i)
+		if len(mailboxes) == 0 {
+			if !spam && !strings.EqualFold(i.Name, imapInbox) {
+				continue
+			}
+		} else if !slices.Contains(mailboxes, i.Name) {
+			continue
+		}
+		infos = append(infos, imapMailboxInfo{
+			name: i.Name,
+			spam: spam,
+		})
+	}
+	if err := <-done; err != nil {
+		return nil, fmt.Errorf("Failed to list imap mailboxes: %w", err)
+	}
+	if len(infos) == 0 {
+		return nil, fmt.Errorf("%w: no imap mailboxes to search", ErrInvalidArgs)
+	}
+	return &imapMailbox{
+		c:         c,
+		mailboxes: infos,
+	}, nil
+}
+
+func (m *imapMailbox) Find(msgid string) (*Found, error) {
+	for _, i := range m.mailboxes {
+		if _, err := m.c.Select(i.name, true); err != nil {
+			return nil, fmt.Errorf("Failed to select imap mailbox %s: %w", i.name, err)
+		}
+		criteria := imap.NewSearchCriteria()
+		criteria.Header.Add(headerMsgID, "<"+msgid+">")
+		uids, err := m.c.UidSearch(criteria)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to search imap mailbox %s: %w", i.name, err)
+		}
+		if len(uids) > 0 {
+			return &Found{
+				Mailbox: i.name,
+				Spam:    i.spam,
+				id:      uids[0],
+			}, nil
+		}
+	}
+	return nil, nil
+}
+
+// Delete deletes only the found message, which requires UIDPLUS, since a
+// plain EXPUNGE would also remove any other message flagged as deleted
+func (m *imapMailbox) Delete(f *Found) error {
+	ok, err := m.c.Support(imapUIDPlus)
+	if err != nil {
+		return fmt.Errorf("Failed to get imap server capabilities: %w", err)
+	}
+	if !ok {
+		return fmt.Errorf("%w: imap server does not support %s to delete a single message", ErrUnsupported, imapUIDPlus)
+	}
+	if _, err := m.c.Select(f.Mailbox, false); err != nil {
+		return fmt.Errorf("Failed to select imap mailbox %s: %w", f.Mailbox, err)
+	}
+	seqset := new(imap.SeqSet)
+	seqset.AddNum(f.id)
+	if err := m.c.UidStore(seqset, imap.FormatFlagsOp(imap.AddFlags, true), []interface{}{imap.DeletedFlag}, nil); err != nil {
+		return fmt.Errorf("Failed to flag imap message as deleted: %w", err)
+	}
+	status, err := m.c.Execute(&commands.Uid{Cmd: &imapExpungeCmd{seqset: seqset}}, nil)
+	if err == nil {
+		err = status.Err()
+	}
+	if err != nil {
+		return fmt.Errorf("Failed to expunge imap message in %s: %w", f.Mailbox, err)
+	}
+	return nil
+}
+
+func (m *imapMailbox) Close() error {
+	if err := m.c.Logout(); err != nil {
+		return fmt.Errorf("Failed to logout of imap server: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+package verify
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	nettextproto "net/textproto"
+	"strconv"
+	"strings"
+
+	"github.com/emersion/go-message"
+	emmail "github.com/emersion/go-message/mail"
+	"github.com/emersion/go-message/textproto"
+)
+
+type (
+	// pop3Mailbox is a minimal pop3 client, since pop3 has no folders and
+	// verification only requires listing, reading headers, and deleting
+	pop3Mailbox struct {
+		c *nettextproto.Conn
+	}
+)
+
+var (
+	ErrPOP3 = errors.New("POP3 error")
+)
+
+const (
+	pop3Inbox = "INBOX"
+)
+
+// dialPOP3 connects to a pop3 server over tls
+func dialPOP3(addr string, username, password string) (_ *pop3Mailbox, retErr error) {
+	conn, err := tls.Dial("tcp", addr, nil)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to connect to pop3 server %s: %w", addr, err)
+	}
+	m := &pop3Mailbox{
+		c: nettextproto.NewConn(conn),
+	}
+	defer func() {
+		if retErr != nil {
+			if err := m.c.Close(); err != nil {
+				retErr = errors.Join(retErr, fmt.Errorf("Failed closing pop3 connection: %w", err))
+			}
+		}
+	}()
+	if _, err := m.readResp(); err != nil {
+		return nil, fmt.Errorf("Failed to greet pop3 server: %w", err)
+	}
+	if _, err := m.cmd("USER %s", username); err != nil {
+		return nil, fmt.Errorf("Failed to login to pop3 server: %w", err)
+	}
+	if _, err := m.cmd("PASS %s", password); err != nil {
+		return nil, fmt.Errorf("Failed to login to pop3 server: %w", err)
+	}
+	return m, nil
+}
+
+func (m *pop3Mailbox) readResp() (string, error) {
+	line, err := m.c.ReadLine()
+	if err != nil {
+		return "", err
+	}
+	if rest, ok := strings.CutPrefix(line, "+OK"); ok {
+		return strings.TrimSpace(rest), nil
+	}
+	return "", fmt.Errorf("%w: %s", ErrPOP3, line)
+}
+
+func (m *pop3Mailbox) cmd(format string, args ...any) (string, error) {
+	if err := m.c.PrintfLine(format, args...); err != nil {
+		return "", err
+	}
+	return m.readResp()
+}
+
+// msgNums lists the message numbers in the mailbox
+func (m *pop3Mailbox) msgNums() ([]uint32, error) {
+	if _, err := m.cmd("LIST"); err != nil {
+		return nil, err
+	}
+	lines, err := m.c.ReadDotLines()
+	if err != nil {
+		return nil, err
+	}
+	nums := make([]uint32, 0, len(lines))
+	for _, i := range lines {
+		numStr, _, _ := strings.Cut(i, " ")
+		num, err := strconv.ParseUint(numStr, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid LIST response %s", ErrPOP3, i)
+		}
+		nums = append(nums, uint32(num))
+	}
+	return nums, nil
+}
+
+// msgID reads the Message-ID of a message from its headers
+func (m *pop3Mailbox) msgID(num uint32) (string, error) {
+	if _, err := m.cmd("TOP %d 0", num); err != nil {
+		return "", err
+	}
+	b, err := m.c.ReadDotBytes()
+	if err != nil {
+		return "", err
+	}
+	h, err := textproto.ReadHeader(bufio.NewReader(bytes.NewReader(b)))
+	if err != nil {
+		// malformed messages in the mailbox are not the message being searched for
+		return "", nil
+	}
+	headers := emmail.Header{
+		Header: message.Header{
+			Header: h,
+		},
+	}
+	msgid, err := headers.MessageID()
+	if err != nil {
+		// malformed messages in the mailbox are not the message being searched for
+		return "", nil
+	}
+	return msgid, nil
+}
+
+func (m *pop3Mailbox) Find(msgid string) (*Found, error) {
+	nums, err := m.msgNums()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to list pop3 messages: %w", err)
+	}
+	// newest messages are last
+	for i := len(nums) - 1; i >= 0; i-- {
+		id, err := m.msgID(nums[i])
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read pop3 message %d: %w", nums[i], err)
+		}
+		if id == msgid {
+			return &Found{
+				Mailbox: pop3Inbox,
+				id:      nums[i],
+			}, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *pop3Mailbox) Delete(f *Found) error {
+	if _, err := m.cmd("DELE %d", f.id); err != nil {
+		return fmt.Errorf("Failed to delete pop3 message %d: %w", f.id, err)
+	}
+	return nil
+}
+
+// Close ends the session, which commits deletions
+func (m *pop3Mailbox) Close() error {
+	_, quitErr := m.cmd("QUIT")
+	if err := m.c.Close(); err != nil {
+		return errors.Join(quitErr, fmt.Errorf("Failed closing pop3 connection: %w", err))
+	}
+	if quitErr != nil {
+		return fmt.Errorf("Failed to quit pop3 session: %w", quitErr)
+	}
+	return nil
+}
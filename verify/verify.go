@@ -0,0 +1,195 @@
+package verify
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"xorkevin.dev/mailcat/send"
+)
+
+type (
+	Opts struct {
+		Proto     string
+		Addr      string
+		Username  string
+		Password  string
+		Mailboxes []string
+		Timeout   time.Duration
+		Interval  time.Duration
+		Delete    bool
+	}
+
+	// Result is the outcome of a successful verification
+	Result struct {
+		MsgID   string
+		Mailbox string
+		Spam    bool
+		Latency time.Duration
+		Deleted bool
+	}
+
+	// Mailbox is a mail store that may be searched for a message
+	Mailbox interface {
+		// Find returns the location of the message, or nil if the message is not
+		// found
+		Find(msgid string) (*Found, error)
+		// Delete deletes a found message
+		Delete(f *Found) error
+		Close() error
+	}
+
+	// Found is the location of a found message
+	Found struct {
+		Mailbox string
+		Spam    bool
+		id      uint32
+		at      time.Time
+	}
+)
+
+var (
+	ErrInvalidArgs = errors.New("Invalid args")
+	ErrNotFound    = errors.New("Message not found")
+	ErrUnsupported = errors.New("Unsupported by server")
+)
+
+const (
+	headerMsgID = "Message-ID"
+)
+
+const (
+	ProtoIMAP = "imap"
+	ProtoPOP3 = "pop3"
+)
+
+// Send sends a message and verifies that it is delivered, writing a report of
+// the result to w
+func Send(r io.Reader, w io.Writer, sendOpts send.Opts, opts Opts) error {
+	// options are checked before sending so that an invalid verify does not
+	// follow a successful send
+	if err := opts.Validate(); err != nil {
+		return err
+	}
+	s := send.New()
+	if err := s.ReadMsg(r); err != nil {
+		return err
+	}
+	start := time.Now()
+	if err := s.Send(sendOpts.Addr, sendOpts.Username, sendOpts.Password, sendOpts.From, sendOpts.To, sendOpts.DKIMSelector, sendOpts.DKIMKeyFile); err != nil {
+		return err
+	}
+	res, err := Verify(s.MsgID(), start, opts)
+	if err != nil {
+		return err
+	}
+	if err := res.WriteReport(w); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Dial connects to a mail store
+func Dial(opts Opts) (Mailbox, error) {
+	switch strings.ToLower(opts.Proto) {
+	case ProtoIMAP, "":
+		return dialIMAP(opts.Addr, opts.Username, opts.Password, opts.Mailboxes, opts.Timeout)
+	case ProtoPOP3:
+		if len(opts.Mailboxes) > 0 {
+			return nil, fmt.Errorf("%w: pop3 has no mailboxes to select", ErrInvalidArgs)
+		}
+		return dialPOP3(opts.Addr, opts.Username, opts.Password)
+	default:
+		return nil, fmt.Errorf("%w: unknown protocol %s", ErrInvalidArgs, opts.Proto)
+	}
+}
+
+// Validate checks that the options describe a verification
+func (o Opts) Validate() error {
+	if o.Addr == "" {
+		return fmt.Errorf("%w: no verify address", ErrInvalidArgs)
+	}
+	if o.Interval <= 0 {
+		return fmt.Errorf("%w: interval must be positive", ErrInvalidArgs)
+	}
+	switch strings.ToLower(o.Proto) {
+	case ProtoIMAP, "":
+	case ProtoPOP3:
+		if len(o.Mailboxes) > 0 {
+			return fmt.Errorf("%w: pop3 has no mailboxes to select", ErrInvalidArgs)
+		}
+	default:
+		return fmt.Errorf("%w: unknown protocol %s", ErrInvalidArgs, o.Proto)
+	}
+	return nil
+}
+
+// Verify polls a mail store until a message with msgid is found or the
+// timeout elapses. Latency is measured from since.
+func Verify(msgid string, since time.Time, opts Opts) (*Result, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	return verify(msgid, since, opts, Dial)
+}
+
+func verify(msgid string, since time.Time, opts Opts, dial func(opts Opts) (Mailbox, error)) (*Result, error) {
+	deadline := time.Now().Add(opts.Timeout)
+	for {
+		found, err := poll(msgid, opts, dial)
+		if err != nil {
+			return nil, err
+		}
+		if found != nil {
+			return &Result{
+				MsgID:   msgid,
+				Mailbox: found.Mailbox,
+				Spam:    found.Spam,
+				Latency: found.at.Sub(since),
+				Deleted: opts.Delete,
+			}, nil
+		}
+		if !time.Now().Add(opts.Interval).Before(deadline) {
+			return nil, fmt.Errorf("%w: %s after %s", ErrNotFound, msgid, opts.Timeout)
+		}
+		time.Sleep(opts.Interval)
+	}
+}
+
+// poll searches for the message in a new session, since some servers only
+// show new mail to new sessions
+func poll(msgid string, opts Opts, dial func(opts Opts) (Mailbox, error)) (_ *Found, retErr error) {
+	m, err := dial(opts)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := m.Close(); err != nil {
+			retErr = errors.Join(retErr, err)
+		}
+	}()
+	found, err := m.Find(msgid)
+	if err != nil {
+		return nil, err
+	}
+	if found == nil {
+		return nil, nil
+	}
+	found.at = time.Now()
+	if opts.Delete {
+		if err := m.Delete(found); err != nil {
+			return nil, err
+		}
+	}
+	return found, nil
+}
+
+// WriteReport writes a human readable report of the result
+func (r *Result) WriteReport(w io.Writer) error {
+	if _, err := fmt.Fprintf(w, "msgid: <%s>\nmailbox: %s\nspam: %t\nlatency: %s\ndeleted: %t\n", r.MsgID, r.Mailbox, r.Spam, r.Latency.Round(time.Millisecond), r.Deleted); err != nil {
+		return fmt.Errorf("Failed writing report: %w", err)
+	}
+	return nil
+}
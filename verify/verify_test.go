@@ -0,0 +1,129 @@
+package verify
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type (
+	fakeMailbox struct {
+		store *fakeStore
+	}
+
+	// fakeStore delivers a message once it has been polled a number of times
+	fakeStore struct {
+		msgid   string
+		after   int
+		polls   int
+		opens   int
+		deleted []string
+		findErr error
+	}
+)
+
+func (s *fakeStore) dial(opts Opts) (Mailbox, error) {
+	s.opens++
+	return &fakeMailbox{
+		store: s,
+	}, nil
+}
+
+func (m *fakeMailbox) Find(msgid string) (*Found, error) {
+	s := m.store
+	if s.findErr != nil {
+		return nil, s.findErr
+	}
+	s.polls++
+	if msgid != s.msgid || s.polls <= s.after {
+		return nil, nil
+	}
+	return &Found{
+		Mailbox: "Junk",
+		Spam:    true,
+	}, nil
+}
+
+func (m *fakeMailbox) Delete(f *Found) error {
+	m.store.deleted = append(m.store.deleted, f.Mailbox)
+	return nil
+}
+
+func (m *fakeMailbox) Close() error {
+	m.store.opens--
+	return nil
+}
+
+func Test_Verify(t *testing.T) {
+	t.Parallel()
+
+	errFind := errors.New("find failed")
+
+	for _, tc := range []struct {
+		Name    string
+		MsgID   string
+		After   int
+		FindErr error
+		Delete  bool
+		Polls   int
+		Deleted []string
+		Err     error
+	}{
+		{
+			Name:  "Finds a delivered message",
+			MsgID: "m1@example.com",
+			Polls: 1,
+		},
+		{
+			Name:    "Polls until the message is delivered",
+			MsgID:   "m1@example.com",
+			After:   2,
+			Delete:  true,
+			Polls:   3,
+			Deleted: []string{"Junk"},
+		},
+		{
+			Name:  "Times out without the message",
+			MsgID: "other@example.com",
+			Err:   ErrNotFound,
+		},
+		{
+			Name:    "Stops on a failed search",
+			MsgID:   "m1@example.com",
+			FindErr: errFind,
+			Err:     errFind,
+		},
+	} {
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			assert := require.New(t)
+
+			store := &fakeStore{
+				msgid:   "m1@example.com",
+				after:   tc.After,
+				findErr: tc.FindErr,
+			}
+			since := time.Now()
+			res, err := verify(tc.MsgID, since, Opts{
+				Timeout:  200 * time.Millisecond,
+				Interval: time.Millisecond,
+				Delete:   tc.Delete,
+			}, store.dial)
+			assert.Zero(store.opens, "every session is closed")
+			if tc.Err != nil {
+				assert.ErrorIs(err, tc.Err)
+				return
+			}
+			assert.NoError(err)
+			assert.Equal(tc.MsgID, res.MsgID)
+			assert.Equal("Junk", res.Mailbox)
+			assert.True(res.Spam)
+			assert.Equal(tc.Delete, res.Deleted)
+			assert.GreaterOrEqual(res.Latency, time.Duration(0))
+			assert.Equal(tc.Polls, store.polls)
+			assert.Equal(tc.Deleted, store.deleted)
+		})
+	}
+}